@@ -1,8 +1,17 @@
 package main
 
-import "github.com/udayangaac/sterna"
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/udayangaac/sterna"
+)
 
 func main() {
 	sterna := sterna.NewSterna()
-	sterna.Start()
+	if err := sterna.Start(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
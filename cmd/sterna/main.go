@@ -0,0 +1,250 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package main sterna command line tool.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/udayangaac/sterna/config"
+	"github.com/udayangaac/sterna/kafka"
+)
+
+const usage = `Usage: sterna <command> [flags]
+
+Commands:
+  reset-offsets  reset the committed offsets of a consumer group
+
+Run "sterna <command> -h" for the flags of a command.
+`
+
+// offsetAdmin resets the committed offsets of a consumer group.
+type offsetAdmin interface {
+	ResetOffsets(reset kafka.OffsetReset) ([]kafka.OffsetChange, error)
+	Close() error
+}
+
+// newOffsetAdmin connects to the cluster, replaced in tests.
+var newOffsetAdmin = func(cfg kafka.ClientConfig) (offsetAdmin, error) {
+	return kafka.NewOffsetAdmin(cfg)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("no command given")
+	}
+	switch args[0] {
+	case "reset-offsets":
+		return resetOffsets(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// topicsFlag topics with optional partitions, e.g. "orders" or "orders:0,1".
+type topicsFlag map[string][]int32
+
+func (t topicsFlag) String() string {
+	topics := make([]string, 0, len(t))
+	for topic := range t {
+		topics = append(topics, topic)
+	}
+	return strings.Join(topics, " ")
+}
+
+func (t topicsFlag) Set(value string) error {
+	topic, partitions, _ := strings.Cut(value, ":")
+	if topic == "" {
+		return fmt.Errorf("empty topic")
+	}
+	var ps []int32
+	if partitions != "" {
+		for _, p := range strings.Split(partitions, ",") {
+			n, err := strconv.ParseInt(p, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid partition %q of %s", p, topic)
+			}
+			ps = append(ps, int32(n))
+		}
+	}
+	t[topic] = append(t[topic], ps...)
+	return nil
+}
+
+// clientFlags client settings of the cluster. The flags which are set
+// override the kafka section of the -config file.
+type clientFlags struct {
+	config       *string
+	brokers      *string
+	version      *string
+	clientID     *string
+	tls          *bool
+	tlsCA        *string
+	tlsCert      *string
+	tlsKey       *string
+	tlsInsecure  *bool
+	saslMech     *string
+	saslUsername *string
+	saslPassword *string
+}
+
+func newClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		config:       fs.String("config", "", "configuration file with the kafka section of the application"),
+		brokers:      fs.String("brokers", "localhost:9092", "comma separated list of the brokers"),
+		version:      fs.String("version", string(kafka.Version_2_1_1), "kafka version"),
+		clientID:     fs.String("client-id", "", "client id"),
+		tls:          fs.Bool("tls", false, "enable TLS"),
+		tlsCA:        fs.String("tls-ca", "", "PEM file of the certificate authorities"),
+		tlsCert:      fs.String("tls-cert", "", "PEM file of the client certificate"),
+		tlsKey:       fs.String("tls-key", "", "PEM file of the client key"),
+		tlsInsecure:  fs.Bool("tls-insecure", false, "skip the verification of the broker certificates"),
+		saslMech:     fs.String("sasl-mechanism", "", "SASL mechanism: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512"),
+		saslUsername: fs.String("sasl-username", "", "SASL username"),
+		saslPassword: fs.String("sasl-password", "", "SASL password, prefer -config to keep it out of the process list"),
+	}
+}
+
+// clientConfig builds the client configurations from the -config file and the
+// flags which are set. The file is not validated as the flags may complete it.
+func (f *clientFlags) clientConfig(fs *flag.FlagSet) (kafka.ClientConfig, error) {
+	var k config.Kafka
+	if *f.config != "" {
+		loader := config.NewLoader()
+		loader.WithoutValidation()
+		cfg, err := loader.Load(*f.config)
+		if err != nil {
+			return kafka.ClientConfig{}, err
+		}
+		k = cfg.Kafka
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	if set["brokers"] || len(k.Brokers) == 0 {
+		k.Brokers = strings.Split(*f.brokers, ",")
+	}
+	if set["version"] || k.Version == "" {
+		k.Version = kafka.Version(*f.version)
+	}
+	if set["client-id"] {
+		k.ClientID = *f.clientID
+	}
+	if set["tls"] {
+		k.TLS.Enabled = *f.tls
+	}
+	if set["tls-ca"] {
+		k.TLS.CAFile = *f.tlsCA
+	}
+	if set["tls-cert"] {
+		k.TLS.CertFile = *f.tlsCert
+	}
+	if set["tls-key"] {
+		k.TLS.KeyFile = *f.tlsKey
+	}
+	if set["tls-insecure"] {
+		k.TLS.InsecureSkipVerify = *f.tlsInsecure
+	}
+	if set["sasl-mechanism"] {
+		k.SASL.Mechanism = kafka.SASLMechanism(*f.saslMech)
+	}
+	if set["sasl-username"] {
+		k.SASL.Username = *f.saslUsername
+	}
+	if set["sasl-password"] {
+		k.SASL.Password = *f.saslPassword
+	}
+	var cfg kafka.ClientConfig
+	k.ApplyClient(&cfg)
+	return cfg, nil
+}
+
+func resetOffsets(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("reset-offsets", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	client := newClientFlags(fs)
+	group := fs.String("group", "", "consumer group")
+	to := fs.String("to", "", "position to reset to: earliest, latest, offset or timestamp")
+	offset := fs.Int64("offset", 0, "offset to reset to with -to offset")
+	timestamp := fs.String("timestamp", "", "RFC 3339 timestamp to reset to with -to timestamp")
+	dryRun := fs.Bool("dry-run", false, "print the plan without committing the offsets")
+	topics := topicsFlag{}
+	fs.Var(topics, "topic", "topic to reset, optionally with partitions, e.g. orders:0,1 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	reset := kafka.OffsetReset{
+		Group:      *group,
+		Partitions: topics,
+		To:         kafka.ResetTo(*to),
+		Offset:     *offset,
+		DryRun:     *dryRun,
+	}
+	if reset.Group == "" {
+		return fmt.Errorf("-group is required")
+	}
+	if len(reset.Partitions) == 0 {
+		return fmt.Errorf("at least one -topic is required")
+	}
+	if reset.To == kafka.ResetTimestamp {
+		t, err := time.Parse(time.RFC3339, *timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid -timestamp: %w", err)
+		}
+		reset.Timestamp = t
+	}
+
+	cfg, err := client.clientConfig(fs)
+	if err != nil {
+		return err
+	}
+	admin, err := newOffsetAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	changes, err := admin.ResetOffsets(reset)
+	if err != nil {
+		return err
+	}
+	writePlan(stdout, changes)
+	if reset.DryRun {
+		fmt.Fprintln(stdout, "Dry run, no offsets were committed.")
+	}
+	return nil
+}
+
+func writePlan(w io.Writer, changes []kafka.OffsetChange) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tPARTITION\tCURRENT\tTARGET")
+	for _, c := range changes {
+		current := "-"
+		if c.Current >= 0 {
+			current = strconv.FormatInt(c.Current, 10)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\n", c.Topic, c.Partition, current, c.Target)
+	}
+	_ = tw.Flush()
+}
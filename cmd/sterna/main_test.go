@@ -0,0 +1,218 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package main
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udayangaac/sterna/kafka"
+)
+
+// fakeAdmin records the requested reset and returns the given changes.
+type fakeAdmin struct {
+	cfg     kafka.ClientConfig
+	reset   kafka.OffsetReset
+	changes []kafka.OffsetChange
+	closed  bool
+}
+
+func (f *fakeAdmin) ResetOffsets(reset kafka.OffsetReset) ([]kafka.OffsetChange, error) {
+	f.reset = reset
+	return f.changes, nil
+}
+
+func (f *fakeAdmin) Close() error {
+	f.closed = true
+	return nil
+}
+
+func withFakeAdmin(t *testing.T, changes ...kafka.OffsetChange) *fakeAdmin {
+	admin := &fakeAdmin{changes: changes}
+	original := newOffsetAdmin
+	newOffsetAdmin = func(cfg kafka.ClientConfig) (offsetAdmin, error) {
+		admin.cfg = cfg
+		return admin, nil
+	}
+	t.Cleanup(func() { newOffsetAdmin = original })
+	return admin
+}
+
+func TestRun_Errors(t *testing.T) {
+	withFakeAdmin(t)
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "no command", args: nil, want: "no command given"},
+		{name: "unknown command", args: []string{"delete"}, want: "unknown command: delete"},
+		{name: "missing group", args: []string{"reset-offsets", "-topic", "orders"}, want: "-group is required"},
+		{name: "missing topic", args: []string{"reset-offsets", "-group", "g"}, want: "at least one -topic is required"},
+		{
+			name: "invalid timestamp",
+			args: []string{"reset-offsets", "-group", "g", "-topic", "orders", "-to", "timestamp", "-timestamp", "yesterday"},
+			want: "invalid -timestamp",
+		},
+		{name: "invalid partition", args: []string{"reset-offsets", "-topic", "orders:x"}, want: `invalid partition "x" of orders`},
+		{name: "unknown flag", args: []string{"reset-offsets", "-partition", "1"}, want: "flag provided but not defined"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := run(test.args, io.Discard, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Expected an error containing %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestTopicsFlag_Set(t *testing.T) {
+	topics := topicsFlag{}
+	for _, value := range []string{"orders", "payments:0,1", "payments:3"} {
+		if err := topics.Set(value); err != nil {
+			t.Fatalf("Found error %s", err)
+		}
+	}
+	expected := topicsFlag{"orders": nil, "payments": {0, 1, 3}}
+	if !reflect.DeepEqual(topics, expected) {
+		t.Errorf("Expected %v, got %v", expected, topics)
+	}
+	if err := topics.Set(":0"); err == nil {
+		t.Errorf("Expected an error for an empty topic")
+	}
+}
+
+func TestResetOffsets_DryRun(t *testing.T) {
+	admin := withFakeAdmin(t,
+		kafka.OffsetChange{Topic: "orders", Partition: 0, Current: 42, Target: 10},
+		kafka.OffsetChange{Topic: "orders", Partition: 1, Current: -1, Target: 7},
+	)
+	stdout := &bytes.Buffer{}
+	err := run([]string{
+		"reset-offsets", "-brokers", "b1:9092,b2:9092", "-group", "g", "-topic", "orders",
+		"-to", "timestamp", "-timestamp", "2022-02-01T00:00:00Z", "-dry-run",
+	}, stdout, io.Discard)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	if !reflect.DeepEqual(admin.cfg.Brokers, []string{"b1:9092", "b2:9092"}) || admin.cfg.Version != kafka.Version_2_1_1 {
+		t.Errorf("Unexpected client configurations %+v", admin.cfg)
+	}
+	expected := kafka.OffsetReset{
+		Group:      "g",
+		Partitions: map[string][]int32{"orders": nil},
+		To:         kafka.ResetTimestamp,
+		Timestamp:  time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		DryRun:     true,
+	}
+	if !reflect.DeepEqual(admin.reset, expected) {
+		t.Errorf("Expected reset %+v, got %+v", expected, admin.reset)
+	}
+	if !admin.closed {
+		t.Errorf("Expected the admin to be closed")
+	}
+
+	plan := "TOPIC   PARTITION  CURRENT  TARGET\n" +
+		"orders  0          42       10\n" +
+		"orders  1          -        7\n" +
+		"Dry run, no offsets were committed.\n"
+	if stdout.String() != plan {
+		t.Errorf("Expected plan\n%s\ngot\n%s", plan, stdout)
+	}
+}
+
+func TestResetOffsets_ClientConfig(t *testing.T) {
+	admin := withFakeAdmin(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := `
+kafka:
+  brokers: [kafka-1:9093]
+  version: 2.8.0
+  client_id: ops
+  tls:
+    enabled: true
+    ca_file: /etc/kafka/ca.pem
+  sasl:
+    mechanism: SCRAM-SHA-512
+    username: admin
+    password: secret
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	err := run([]string{
+		"reset-offsets", "-config", path, "-client-id", "sterna", "-sasl-username", "operator",
+		"-group", "g", "-topic", "orders", "-to", "earliest",
+	}, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	expected := kafka.ClientConfig{
+		Brokers:  []string{"kafka-1:9093"},
+		Version:  "2.8.0",
+		ClientID: "sterna",
+		TLS:      &kafka.TLSConfig{CAFile: "/etc/kafka/ca.pem"},
+		SASL:     &kafka.SASLConfig{Mechanism: kafka.SASLScramSHA512, Username: "operator", Password: "secret"},
+	}
+	if !reflect.DeepEqual(admin.cfg, expected) {
+		t.Errorf("Expected client configurations %+v, got %+v", expected, admin.cfg)
+	}
+}
+
+func TestResetOffsets_ConfigCompletedByFlags(t *testing.T) {
+	admin := withFakeAdmin(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := `
+kafka:
+  sasl:
+    mechanism: PLAIN
+    username: admin
+    password: secret
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	err := run([]string{
+		"reset-offsets", "-config", path, "-brokers", "kafka-1:9093", "-group", "g", "-topic", "orders", "-to", "earliest",
+	}, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if !reflect.DeepEqual(admin.cfg.Brokers, []string{"kafka-1:9093"}) || admin.cfg.SASL == nil {
+		t.Errorf("Unexpected client configurations %+v", admin.cfg)
+	}
+}
+
+func TestResetOffsets_ClientFlags(t *testing.T) {
+	admin := withFakeAdmin(t)
+	err := run([]string{
+		"reset-offsets", "-tls", "-tls-insecure", "-sasl-mechanism", "PLAIN", "-sasl-username", "u",
+		"-sasl-password", "p", "-group", "g", "-topic", "orders", "-to", "latest",
+	}, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	expected := kafka.ClientConfig{
+		Brokers: []string{"localhost:9092"},
+		Version: kafka.Version_2_1_1,
+		TLS:     &kafka.TLSConfig{InsecureSkipVerify: true},
+		SASL:    &kafka.SASLConfig{Mechanism: kafka.SASLPlain, Username: "u", Password: "p"},
+	}
+	if !reflect.DeepEqual(admin.cfg, expected) {
+		t.Errorf("Expected client configurations %+v, got %+v", expected, admin.cfg)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package sterna consist of all functions of microservice framework.
+package sterna
+
+import (
+	"context"
+)
+
+// Component a part of the application managed by Sterna (consumer groups,
+// producers, servers, background workers).
+type Component interface {
+	// Start starts the component. It should return once the component is
+	// running. ctx is cancelled when the application starts shutting down.
+	Start(ctx context.Context) error
+	// Stop stops the component. ctx expires at the shutdown deadline.
+	Stop(ctx context.Context) error
+}
+
+// Failer is implemented by components which can fail after Start returned.
+// The application shuts down when an error is received from Failed.
+type Failer interface {
+	Failed() <-chan error
+}
+
+type componentFuncs struct {
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+// NewComponent creates a component from start and stop functions. Both
+// functions are optional.
+func NewComponent(start, stop func(ctx context.Context) error) Component {
+	return &componentFuncs{start: start, stop: stop}
+}
+
+func (c *componentFuncs) Start(ctx context.Context) error {
+	if c.start == nil {
+		return nil
+	}
+	return c.start(ctx)
+}
+
+func (c *componentFuncs) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop(ctx)
+}
+
+type runner struct {
+	run    func(ctx context.Context) error
+	cancel context.CancelFunc
+	done   chan struct{}
+	failed chan error
+}
+
+// NewRunner creates a component from a blocking function. Start calls run in
+// a new goroutine and Stop cancels the context given to run and waits until it
+// returns. An error returned by run before Stop is called fails the
+// application.
+func NewRunner(run func(ctx context.Context) error) Component {
+	return &runner{
+		run:    run,
+		failed: make(chan error, 1),
+	}
+}
+
+func (r *runner) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		if err := r.run(ctx); err != nil && ctx.Err() == nil {
+			r.failed <- err
+		}
+	}()
+	return nil
+}
+
+func (r *runner) Stop(ctx context.Context) error {
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *runner) Failed() <-chan error {
+	return r.failed
+}
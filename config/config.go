@@ -0,0 +1,303 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package config loads the configurations of the application from YAML/JSON
+// files and environment variables.
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/kafka"
+	"github.com/udayangaac/sterna/kafka/avro"
+	"github.com/udayangaac/sterna/log"
+)
+
+const (
+	kafkaKey          = "kafka"
+	schemaRegistryKey = "schema_registry"
+	logKey            = "log"
+)
+
+// Kafka configurations of the kafka module.
+type Kafka struct {
+	Brokers         []string              `yaml:"brokers"`
+	Group           string                `yaml:"group"`
+	Version         kafka.Version         `yaml:"version"`
+	Topics          []string              `yaml:"topics"`
+	Offset          kafka.Offset          `yaml:"offset"`
+	BalanceStrategy kafka.BalanceStrategy `yaml:"balance_strategy"`
+	ClientID        string                `yaml:"client_id"`
+	TLS             KafkaTLS              `yaml:"tls"`
+	SASL            KafkaSASL             `yaml:"sasl"`
+
+	SessionTimeout    time.Duration `yaml:"session_timeout"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	RebalanceTimeout  time.Duration `yaml:"rebalance_timeout"`
+	FetchMinBytes     int32         `yaml:"fetch_min_bytes"`
+	FetchMaxBytes     int32         `yaml:"fetch_max_bytes"`
+	MaxProcessingTime time.Duration `yaml:"max_processing_time"`
+	ChannelBufferSize int           `yaml:"channel_buffer_size"`
+
+	IsolationLevel kafka.IsolationLevel `yaml:"isolation_level"`
+
+	Producer KafkaProducer `yaml:"producer"`
+}
+
+// KafkaProducer configurations of the kafka producers.
+type KafkaProducer struct {
+	Acks            kafka.Acks        `yaml:"acks"`
+	Compression     kafka.Compression `yaml:"compression"`
+	Idempotent      bool              `yaml:"idempotent"`
+	RetryMax        int               `yaml:"retry_max"`
+	RetryBackoff    time.Duration     `yaml:"retry_backoff"`
+	MaxMessageBytes int               `yaml:"max_message_bytes"`
+	Partitioner     kafka.Partitioner `yaml:"partitioner"`
+
+	Linger           time.Duration `yaml:"linger"`
+	BatchMessages    int           `yaml:"batch_messages"`
+	BatchBytes       int           `yaml:"batch_bytes"`
+	MaxBatchMessages int           `yaml:"max_batch_messages"`
+
+	TransactionalID string `yaml:"transactional_id"`
+}
+
+// KafkaTLS TLS configurations of the kafka connections.
+type KafkaTLS struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// KafkaSASL SASL configurations of the kafka connections. SASL is enabled
+// when the mechanism is set.
+type KafkaSASL struct {
+	Mechanism kafka.SASLMechanism `yaml:"mechanism"`
+	Username  string              `yaml:"username"`
+	Password  string              `yaml:"password"`
+}
+
+// SchemaRegistry configurations of the schema registry client.
+type SchemaRegistry struct {
+	URLs    []string `yaml:"urls"`
+	Retries int      `yaml:"retries"`
+}
+
+// Log configurations of the logger.
+type Log struct {
+	Level      log.Level `yaml:"level"`
+	ProjectDir string    `yaml:"project_dir"`
+}
+
+// Validator is implemented by application sections which validate themselves.
+// Returning FieldError or ValidationErrors keeps the offending keys in the error.
+type Validator interface {
+	Validate() error
+}
+
+// Config configurations of the framework modules and the application sections.
+type Config struct {
+	Kafka          Kafka
+	SchemaRegistry SchemaRegistry
+	Log            Log
+
+	loader  *Loader
+	raw     map[string]interface{}
+	present map[string]bool
+	// positions file and line of the keys, e.g. "app.yaml:3" for kafka.brokers.
+	positions map[string]string
+}
+
+func newConfig(loader *Loader, raw map[string]interface{}, positions map[string]string) *Config {
+	return &Config{
+		Kafka: Kafka{
+			Version:         kafka.Version_2_1_1,
+			Offset:          kafka.Newest,
+			BalanceStrategy: kafka.Range,
+		},
+		SchemaRegistry: SchemaRegistry{
+			Retries: -1,
+		},
+		Log: Log{
+			Level: log.Info,
+		},
+		loader:    loader,
+		raw:       raw,
+		present:   make(map[string]bool),
+		positions: positions,
+	}
+}
+
+// bind binds and validates the framework sections.
+func (c *Config) bind() error {
+	var errs ValidationErrors
+	errs = append(errs, c.bindSection(kafkaKey, &c.Kafka)...)
+	errs = append(errs, c.bindSection(schemaRegistryKey, &c.SchemaRegistry)...)
+	errs = append(errs, c.bindSection(logKey, &c.Log)...)
+	if len(errs) == 0 && !c.loader.skipValidation {
+		errs = c.validate()
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) bindSection(key string, out interface{}) ValidationErrors {
+	section, ok := c.raw[key]
+	errs := c.decode(key, section, out)
+	touched, envErrs := c.loader.applyEnv(key, reflect.ValueOf(out).Elem())
+	c.present[key] = ok || touched
+	return append(errs, envErrs...)
+}
+
+// validate validates the framework sections which are present in the files or the environment.
+func (c *Config) validate() (errs ValidationErrors) {
+	if c.present[kafkaKey] {
+		k := c.Kafka
+		if len(k.Brokers) == 0 {
+			errs = append(errs, &FieldError{Key: "kafka.brokers", Message: "at least one broker is required"})
+		}
+		if _, err := sarama.ParseKafkaVersion(string(k.Version)); err != nil {
+			errs = append(errs, &FieldError{Key: "kafka.version", Message: err.Error()})
+		}
+		switch k.Offset {
+		case kafka.Newest, kafka.Oldest:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.offset", Message: fmt.Sprintf("unknown offset %q", k.Offset)})
+		}
+		switch k.BalanceStrategy {
+		case kafka.Sticky, kafka.RoundRobin, kafka.Range:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.balance_strategy", Message: fmt.Sprintf("unknown strategy %q", k.BalanceStrategy)})
+		}
+		switch k.IsolationLevel {
+		case "", kafka.ReadUncommitted, kafka.ReadCommitted:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.isolation_level", Message: fmt.Sprintf("unknown isolation level %q", k.IsolationLevel)})
+		}
+		switch k.SASL.Mechanism {
+		case "", kafka.SASLPlain, kafka.SASLScramSHA256, kafka.SASLScramSHA512:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.sasl.mechanism", Message: fmt.Sprintf("unknown mechanism %q", k.SASL.Mechanism)})
+		}
+		switch k.Producer.Acks {
+		case "", kafka.AcksNone, kafka.AcksLeader, kafka.AcksAll:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.producer.acks", Message: fmt.Sprintf("unknown acks %q", k.Producer.Acks)})
+		}
+		switch k.Producer.Compression {
+		case "", kafka.CompressionNone, kafka.CompressionGzip, kafka.CompressionSnappy, kafka.CompressionLZ4, kafka.CompressionZstd:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.producer.compression", Message: fmt.Sprintf("unknown compression %q", k.Producer.Compression)})
+		}
+		switch k.Producer.Partitioner {
+		case "", kafka.HashPartitioner, kafka.RandomPartitioner, kafka.RoundRobinPartitioner, kafka.ManualPartitioner:
+		default:
+			errs = append(errs, &FieldError{Key: "kafka.producer.partitioner", Message: fmt.Sprintf("unknown partitioner %q", k.Producer.Partitioner)})
+		}
+	}
+	if c.present[schemaRegistryKey] && len(c.SchemaRegistry.URLs) == 0 {
+		errs = append(errs, &FieldError{Key: "schema_registry.urls", Message: "at least one url is required"})
+	}
+	switch c.Log.Level {
+	case log.Debug, log.Info, log.Warn, log.Error, log.Fatal, log.Panic:
+	default:
+		errs = append(errs, &FieldError{Key: "log.level", Message: fmt.Sprintf("unknown level %q", c.Log.Level)})
+	}
+	return
+}
+
+// Section binds the application section with the given name to a value of
+// type T. Environment variables override the section the same way as the
+// framework sections, e.g. STERNA_ORDERS_DB_HOST for orders.db.host.
+func Section[T any](c *Config, name string) (out T, err error) {
+	errs := c.decode(name, c.raw[name], &out)
+	_, envErrs := c.loader.applyEnv(name, reflect.ValueOf(&out).Elem())
+	errs = append(errs, envErrs...)
+	if len(errs) > 0 {
+		return out, errs
+	}
+	if v, ok := interface{}(&out).(Validator); ok {
+		if err = v.Validate(); err != nil {
+			return out, withPrefix(name, err)
+		}
+	}
+	return out, nil
+}
+
+// ApplyClient sets the client configurations to the given kafka.ClientConfig.
+func (k Kafka) ApplyClient(cfg *kafka.ClientConfig) {
+	cfg.Brokers = k.Brokers
+	cfg.Version = k.Version
+	cfg.ClientID = k.ClientID
+	if k.TLS.Enabled {
+		cfg.TLS = &kafka.TLSConfig{
+			CAFile:             k.TLS.CAFile,
+			CertFile:           k.TLS.CertFile,
+			KeyFile:            k.TLS.KeyFile,
+			InsecureSkipVerify: k.TLS.InsecureSkipVerify,
+		}
+	}
+	if k.SASL.Mechanism != "" {
+		cfg.SASL = &kafka.SASLConfig{
+			Mechanism: k.SASL.Mechanism,
+			Username:  k.SASL.Username,
+			Password:  k.SASL.Password,
+		}
+	}
+}
+
+// Apply sets the kafka configurations to the given kafka.ConsumerConfig.
+func (k Kafka) Apply(cfg *kafka.ConsumerConfig) {
+	k.ApplyClient(&cfg.ClientConfig)
+	cfg.Group = k.Group
+	cfg.Topics = k.Topics
+	cfg.Offset = k.Offset
+	cfg.BalanceStrategy = k.BalanceStrategy
+	cfg.SessionTimeout = k.SessionTimeout
+	cfg.HeartbeatInterval = k.HeartbeatInterval
+	cfg.RebalanceTimeout = k.RebalanceTimeout
+	cfg.FetchMinBytes = k.FetchMinBytes
+	cfg.FetchMaxBytes = k.FetchMaxBytes
+	cfg.MaxProcessingTime = k.MaxProcessingTime
+	cfg.ChannelBufferSize = k.ChannelBufferSize
+	cfg.IsolationLevel = k.IsolationLevel
+}
+
+// ApplyProducer sets the kafka configurations to the given kafka.ProducerConfig.
+func (k Kafka) ApplyProducer(cfg *kafka.ProducerConfig) {
+	k.ApplyClient(&cfg.ClientConfig)
+	cfg.Acks = k.Producer.Acks
+	cfg.Compression = k.Producer.Compression
+	cfg.Idempotent = k.Producer.Idempotent
+	cfg.RetryMax = k.Producer.RetryMax
+	cfg.RetryBackoff = k.Producer.RetryBackoff
+	cfg.MaxMessageBytes = k.Producer.MaxMessageBytes
+	cfg.Partitioner = k.Producer.Partitioner
+	cfg.Linger = k.Producer.Linger
+	cfg.BatchMessages = k.Producer.BatchMessages
+	cfg.BatchBytes = k.Producer.BatchBytes
+	cfg.MaxBatchMessages = k.Producer.MaxBatchMessages
+	cfg.TransactionalID = k.Producer.TransactionalID
+}
+
+// NewClient creates a cached schema registry client.
+func (s SchemaRegistry) NewClient() avro.SchemaRegistry {
+	return avro.NewCachedSchemaRegistry(s.URLs, s.Retries)
+}
+
+// LoggerConfig creates log.Config from the log configurations.
+func (l Log) LoggerConfig() *log.Config {
+	conf := log.NewConfig()
+	conf.WithLogLevel(l.Level)
+	conf.ProjectDir(l.ProjectDir)
+	return conf
+}
@@ -0,0 +1,221 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package config
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/udayangaac/sterna/kafka"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	return path
+}
+
+func newTestLoader(env map[string]string) *Loader {
+	l := NewLoader()
+	l.lookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	return l
+}
+
+func TestLoader_LoadWithEnvOverrides(t *testing.T) {
+	yamlFile := writeFile(t, "app.yaml", `
+kafka:
+  brokers: [localhost:9092]
+  group: orders
+  topics: [orders]
+  offset: oldest
+  session_timeout: 20s
+  sasl:
+    mechanism: SCRAM-SHA-512
+    username: orders
+log:
+  level: debug
+`)
+	jsonFile := writeFile(t, "override.json", `{"kafka": {"group": "orders-v2"}}`)
+	l := newTestLoader(map[string]string{
+		"STERNA_KAFKA_BROKERS":          "b1:9092, b2:9092",
+		"STERNA_KAFKA_BALANCE_STRATEGY": "sticky",
+		"STERNA_KAFKA_SASL_PASSWORD":    "secret",
+	})
+	cfg, err := l.Load(yamlFile, jsonFile)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	expected := Kafka{
+		Brokers:         []string{"b1:9092", "b2:9092"},
+		Group:           "orders-v2",
+		Version:         kafka.Version_2_1_1,
+		Topics:          []string{"orders"},
+		Offset:          kafka.Oldest,
+		BalanceStrategy: kafka.Sticky,
+		SASL: KafkaSASL{
+			Mechanism: kafka.SASLScramSHA512,
+			Username:  "orders",
+			Password:  "secret",
+		},
+		SessionTimeout: 20 * time.Second,
+	}
+	if !reflect.DeepEqual(cfg.Kafka, expected) {
+		t.Errorf("Expected kafka configurations %+v, got %+v", expected, cfg.Kafka)
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("Expected log level debug, got %s", cfg.Log.Level)
+	}
+}
+
+func TestLoader_ValidationErrorsNameKeys(t *testing.T) {
+	file := writeFile(t, "app.yaml", `
+kafka:
+  offset: latest
+`)
+	_, err := newTestLoader(map[string]string{"STERNA_SCHEMA_REGISTRY_RETRIES": "three"}).Load(file)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	keys := make([]string, 0, len(errs))
+	for _, e := range errs {
+		keys = append(keys, e.Key)
+	}
+	expected := []string{"schema_registry.retries"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, keys)
+	}
+
+	_, err = newTestLoader(nil).Load(file)
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	keys = keys[:0]
+	for _, e := range errs {
+		keys = append(keys, e.Key)
+	}
+	expected = []string{"kafka.brokers", "kafka.offset"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, keys)
+	}
+	// The errors are the ones of the kafka package.
+	var kafkaErrs kafka.ValidationErrors
+	if !errors.As(err, &kafkaErrs) || !kafkaErrs.Has("kafka.brokers") {
+		t.Errorf("Expected kafka validation errors with kafka.brokers, got %v", err)
+	}
+
+	l := newTestLoader(nil)
+	l.WithoutValidation()
+	if _, err = l.Load(file); err != nil {
+		t.Errorf("Expected the framework sections not to be validated, got %v", err)
+	}
+}
+
+func TestLoader_TypeErrorsNameKeys(t *testing.T) {
+	file := writeFile(t, "app.yaml", `
+kafka:
+  brokers: [localhost:9092]
+  fetch_min_bytes: abc
+  tls:
+    enabled: maybe
+log:
+  level: info
+`)
+	_, err := newTestLoader(nil).Load(file)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	// The errors are in the order of the fields.
+	expected := ValidationErrors{
+		{Key: "kafka.tls.enabled", Message: "cannot unmarshal !!str `maybe` into bool (app.yaml:6)"},
+		{Key: "kafka.fetch_min_bytes", Message: "cannot unmarshal !!str `abc` into int32 (app.yaml:4)"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors %v, got %v", expected, errs)
+	}
+}
+
+type ordersSection struct {
+	DB struct {
+		Host string `yaml:"host"`
+	} `yaml:"db"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (o ordersSection) Validate() error {
+	if o.DB.Host == "" {
+		return &FieldError{Key: "db.host", Message: "required"}
+	}
+	return nil
+}
+
+func TestSection(t *testing.T) {
+	file := writeFile(t, "app.yaml", `
+orders:
+  timeout: 5s
+`)
+	cfg, err := newTestLoader(map[string]string{"STERNA_ORDERS_DB_HOST": "db:5432"}).Load(file)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	orders, err := Section[ordersSection](cfg, "orders")
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if orders.DB.Host != "db:5432" || orders.Timeout != 5*time.Second {
+		t.Errorf("Unexpected section %+v", orders)
+	}
+
+	cfg, _ = newTestLoader(nil).Load(file)
+	_, err = Section[ordersSection](cfg, "orders")
+	if err == nil || err.Error() != "invalid configurations: orders.db.host: required" {
+		t.Errorf("Expected validation error of orders.db.host, got %v", err)
+	}
+}
+
+func TestKafka_Apply(t *testing.T) {
+	file := writeFile(t, "app.yaml", `
+kafka:
+  brokers: [localhost:9092]
+  group: orders
+  topics: [orders]
+  client_id: orders-service
+  isolation_level: read_committed
+  producer:
+    acks: leader
+    compression: gzip
+    retry_backoff: 200ms
+    transactional_id: orders-1
+`)
+	cfg, err := newTestLoader(nil).Load(file)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	var consumer kafka.ConsumerConfig
+	cfg.Kafka.Apply(&consumer)
+	if consumer.Group != "orders" || consumer.ClientID != "orders-service" || consumer.Version != kafka.Version_2_1_1 ||
+		consumer.IsolationLevel != kafka.ReadCommitted {
+		t.Errorf("Unexpected consumer configurations %+v", consumer)
+	}
+	var producer kafka.ProducerConfig
+	cfg.Kafka.ApplyProducer(&producer)
+	if producer.ClientID != "orders-service" || producer.Acks != kafka.AcksLeader ||
+		producer.Compression != kafka.CompressionGzip || producer.RetryBackoff != 200*time.Millisecond ||
+		producer.TransactionalID != "orders-1" {
+		t.Errorf("Unexpected producer configurations %+v", producer)
+	}
+}
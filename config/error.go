@@ -0,0 +1,32 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package config
+package config
+
+import "github.com/udayangaac/sterna/kafka"
+
+// FieldError validation error of a single configuration key. It is the
+// type of the kafka package, so the errors of both are handled the same way.
+type FieldError = kafka.FieldError
+
+// ValidationErrors all the validation errors found while loading the configurations.
+type ValidationErrors = kafka.ValidationErrors
+
+// withPrefix prefixes the keys of the errors returned by a section validator.
+func withPrefix(prefix string, err error) ValidationErrors {
+	switch e := err.(type) {
+	case ValidationErrors:
+		errs := make(ValidationErrors, 0, len(e))
+		for _, fe := range e {
+			errs = append(errs, &FieldError{Key: prefix + "." + fe.Key, Message: fe.Message})
+		}
+		return errs
+	case *FieldError:
+		return ValidationErrors{{Key: prefix + "." + e.Key, Message: e.Message}}
+	default:
+		return ValidationErrors{{Key: prefix, Message: err.Error()}}
+	}
+}
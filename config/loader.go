@@ -0,0 +1,322 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package config
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix prefix of the environment variables overriding the configurations.
+const DefaultEnvPrefix = "STERNA"
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// Loader loads configuration files and environment variables.
+type Loader struct {
+	envPrefix      string
+	lookupEnv      func(key string) (string, bool)
+	skipValidation bool
+}
+
+// NewLoader creates a loader reading environment variables with DefaultEnvPrefix.
+func NewLoader() *Loader {
+	return &Loader{
+		envPrefix: DefaultEnvPrefix,
+		lookupEnv: os.LookupEnv,
+	}
+}
+
+// WithEnvPrefix sets the prefix of the environment variables.
+func (l *Loader) WithEnvPrefix(prefix string) {
+	l.envPrefix = prefix
+}
+
+// WithoutValidation skips the validation of the framework sections, e.g. for
+// tools completing them from their flags. Type errors are still reported.
+func (l *Loader) WithoutValidation() {
+	l.skipValidation = true
+}
+
+// Load loads the configurations with the default loader.
+func Load(paths ...string) (*Config, error) {
+	return NewLoader().Load(paths...)
+}
+
+// Load reads the given YAML/JSON files in order, later files overriding the
+// earlier ones, then applies environment variable overrides and validates the
+// framework sections.
+func (l *Loader) Load(paths ...string) (*Config, error) {
+	raw := make(map[string]interface{})
+	positions := make(map[string]string)
+	for _, path := range paths {
+		doc, err := readFile(path, positions)
+		if err != nil {
+			return nil, err
+		}
+		merge(raw, doc)
+	}
+	cfg := newConfig(l, raw, positions)
+	if err := cfg.bind(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile parses the file and records the position of its keys in positions,
+// e.g. "app.yaml:3" for kafka.brokers.
+func readFile(path string, positions map[string]string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration file: %w", err)
+	}
+	doc := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("unsupported configuration file: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration file %s: %w", path, err)
+	}
+	// JSON is valid YAML, the nodes of both formats have the lines of the keys.
+	var node yaml.Node
+	if yaml.Unmarshal(data, &node) == nil {
+		collectPositions(&node, "", filepath.Base(path), positions)
+	}
+	return doc, nil
+}
+
+// collectPositions records the file and the line of the keys of node.
+func collectPositions(node *yaml.Node, prefix, file string, positions map[string]string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			collectPositions(n, prefix, file, positions)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			positions[key] = fmt.Sprintf("%s:%d", file, node.Content[i].Line)
+			collectPositions(node.Content[i+1], key, file, positions)
+		}
+	}
+}
+
+// merge merges src into dst recursively. Values in src take precedence.
+func merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			merge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decode binds the raw section to out field by field, so that the errors name
+// the offending keys. out keeps its values for keys missing in the section.
+func (c *Config) decode(key string, section interface{}, out interface{}) ValidationErrors {
+	if section == nil {
+		return nil
+	}
+	return c.decodeValue(key, section, reflect.ValueOf(out).Elem())
+}
+
+func (c *Config) decodeValue(key string, raw interface{}, v reflect.Value) (errs ValidationErrors) {
+	fields, ok := raw.(map[string]interface{})
+	if !ok || !hasFields(v.Type()) {
+		if err := unmarshal(raw, v); err != nil {
+			return ValidationErrors{{Key: key, Message: c.at(key, err)}}
+		}
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := fieldName(field)
+		value, ok := fields[name]
+		if !field.IsExported() || name == "" || !ok {
+			continue
+		}
+		errs = append(errs, c.decodeValue(key+"."+name, value, v.Field(i))...)
+	}
+	return errs
+}
+
+// hasFields reports whether the values of t are decoded field by field.
+func hasFields(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+func unmarshal(raw interface{}, v reflect.Value) error {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, v.Addr().Interface())
+}
+
+// at returns the message of err with the position of the key in the files.
+// The lines of the re-marshaled value are dropped as they are not the ones of
+// the files.
+func (c *Config) at(key string, err error) string {
+	msg := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs := make([]string, 0, len(typeErr.Errors))
+		for _, m := range typeErr.Errors {
+			if strings.HasPrefix(m, "line ") {
+				if _, rest, ok := strings.Cut(m, ": "); ok {
+					m = rest
+				}
+			}
+			msgs = append(msgs, m)
+		}
+		msg = strings.Join(msgs, "; ")
+	}
+	if pos, ok := c.positions[key]; ok {
+		return fmt.Sprintf("%s (%s)", msg, pos)
+	}
+	return msg
+}
+
+// applyEnv overrides the fields of the struct v from the environment. The
+// variable name of a field is the upper cased key path joined by underscores,
+// e.g. STERNA_KAFKA_BROKERS for kafka.brokers.
+func (l *Loader) applyEnv(key string, v reflect.Value) (touched bool, errs ValidationErrors) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := fieldName(field)
+		if !field.IsExported() || name == "" {
+			continue
+		}
+		fieldKey := key + "." + name
+		fieldValue := v.Field(i)
+		if fieldValue.Kind() == reflect.Struct {
+			fieldTouched, fieldErrs := l.applyEnv(fieldKey, fieldValue)
+			touched = touched || fieldTouched
+			errs = append(errs, fieldErrs...)
+			continue
+		}
+		envName := l.envName(fieldKey)
+		raw, ok := l.lookupEnv(envName)
+		if !ok {
+			continue
+		}
+		touched = true
+		if err := setValue(fieldValue, raw); err != nil {
+			errs = append(errs, &FieldError{
+				Key:     fieldKey,
+				Message: fmt.Sprintf("invalid value %q from %s: %v", raw, envName, err),
+			})
+		}
+	}
+	return
+}
+
+func (l *Loader) envName(key string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(key)
+	if l.envPrefix == "" {
+		return strings.ToUpper(name)
+	}
+	return strings.ToUpper(l.envPrefix + "_" + name)
+}
+
+// fieldName returns the key of the struct field following the yaml conventions.
+func fieldName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	switch tag {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(field.Name)
+	default:
+		return tag
+	}
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ require (
 	github.com/Shopify/sarama v1.37.2
 	github.com/linkedin/goavro/v2 v2.12.0
 	github.com/rs/zerolog v1.28.0
+	github.com/xdg-go/scram v1.1.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -27,7 +29,10 @@ require (
 	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/pierrec/lz4/v4 v4.1.17 // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
 	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa // indirect
 	golang.org/x/net v0.0.0-20220927171203-f486391704dc // indirect
 	golang.org/x/sys v0.0.0-20220728004956-3c1f35247d10 // indirect
+	golang.org/x/text v0.3.8 // indirect
 )
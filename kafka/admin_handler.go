@@ -0,0 +1,112 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// pauseRequest body of the pause and resume requests. Everything is paused or
+// resumed if both fields are empty.
+type pauseRequest struct {
+	Topics     []string           `json:"topics"`
+	Partitions map[string][]int32 `json:"partitions"`
+}
+
+type adminHandler struct {
+	cg  ConsumerGroup
+	mux *http.ServeMux
+}
+
+// NewAdminHandler creates the admin HTTP API of the consumer group.
+//
+//	GET  /state   returns the ConsumerState.
+//	GET  /lag     returns the lag of the last check, if the lag is monitored.
+//	POST /pause   pauses the topics/partitions in the body, or everything.
+//	POST /resume  resumes the topics/partitions in the body, or everything.
+//
+// The body of pause and resume is {"topics": [...], "partitions": {"topic": [0, 1]}}.
+// Mount the handler with http.StripPrefix to serve it under a path prefix.
+func NewAdminHandler(cg ConsumerGroup) http.Handler {
+	h := &adminHandler{cg: cg, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/state", h.state)
+	h.mux.HandleFunc("/lag", h.lag)
+	h.mux.HandleFunc("/pause", h.pause)
+	h.mux.HandleFunc("/resume", h.resume)
+	return h
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *adminHandler) state(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, h.cg.State())
+}
+
+func (h *adminHandler) lag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lag := h.cg.State().Lag
+	if lag == nil {
+		lag = []PartitionLag{}
+	}
+	writeJSON(w, lag)
+}
+
+func (h *adminHandler) pause(w http.ResponseWriter, r *http.Request) {
+	req, ok := readPauseRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(req.Topics) > 0 || len(req.Partitions) == 0 {
+		h.cg.Pause(req.Topics...)
+	}
+	if len(req.Partitions) > 0 {
+		h.cg.PausePartitions(req.Partitions)
+	}
+	writeJSON(w, h.cg.State())
+}
+
+func (h *adminHandler) resume(w http.ResponseWriter, r *http.Request) {
+	req, ok := readPauseRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(req.Topics) > 0 || len(req.Partitions) == 0 {
+		h.cg.Resume(req.Topics...)
+	}
+	if len(req.Partitions) > 0 {
+		h.cg.ResumePartitions(req.Partitions)
+	}
+	writeJSON(w, h.cg.State())
+}
+
+func readPauseRequest(w http.ResponseWriter, r *http.Request) (req pauseRequest, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	return req, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
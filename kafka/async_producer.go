@@ -0,0 +1,270 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// reportsBufferSize capacity of the channel returned by AsyncProducer.Reports.
+const reportsBufferSize = 256
+
+// ErrProducerClosed is reported for the messages sent after Close.
+var ErrProducerClosed = errors.New("producer is closed")
+
+// DeliveryReport result of an asynchronously produced message.
+type DeliveryReport struct {
+	Message   *sarama.ProducerMessage
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// DeliveryCallback is called once the message is delivered or failed. It is
+// called from the goroutine reading the results of the producer, so it must
+// not block.
+type DeliveryCallback func(report DeliveryReport)
+
+// DeliveryFuture delivery of a message produced with AsyncProducer.SendFuture.
+type DeliveryFuture struct {
+	done   chan struct{}
+	report DeliveryReport
+}
+
+// Done is closed once the message is delivered or failed.
+func (f *DeliveryFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits until the message is delivered or failed, or ctx is done.
+func (f *DeliveryFuture) Wait(ctx context.Context) (partition int32, offset int64, err error) {
+	select {
+	case <-f.done:
+		return f.report.Partition, f.report.Offset, f.report.Err
+	case <-ctx.Done():
+		return -1, -1, ctx.Err()
+	}
+}
+
+// AsyncProducer kafka message producer which does not wait for the brokers.
+// The messages are batched according to the Linger, BatchMessages and
+// BatchBytes settings of ProducerConfig.
+type AsyncProducer interface {
+	// Send produces the message and calls callback once it is delivered or
+	// failed. The delivery is sent to Reports instead if callback is nil
+	// and ProducerConfig.ReturnReports is enabled.
+	Send(msg *sarama.ProducerMessage, callback DeliveryCallback)
+	// SendFuture produces the message and returns the future of its delivery.
+	SendFuture(msg *sarama.ProducerMessage) *DeliveryFuture
+	// Reports returns the deliveries of the messages sent without callback.
+	// They are only reported when ProducerConfig.ReturnReports is enabled and
+	// the channel must be read, otherwise the producer blocks.
+	Reports() <-chan DeliveryReport
+	// Flush waits until all the sent messages are delivered or failed, or ctx is done.
+	Flush(ctx context.Context) error
+	// Close waits for the sent messages and closes the producer. Messages sent
+	// after Close fail with ErrProducerClosed.
+	Close() error
+	// Ready returns an error if the brokers are not reachable.
+	Ready(ctx context.Context) error
+}
+
+// delivery tracks a sent message. It is kept in the metadata of the message
+// until the message is delivered.
+type delivery struct {
+	metadata interface{}
+	callback DeliveryCallback
+	sent     time.Time
+}
+
+type asyncProducer struct {
+	client   sarama.Client
+	producer sarama.AsyncProducer
+	cfg      ProducerConfig
+	metrics  *producerMetrics
+	reports  chan DeliveryReport
+	wg       sync.WaitGroup
+
+	// mu guards closed, Send holds it while writing to the input of the producer.
+	mu     sync.RWMutex
+	closed bool
+	// inFlight number of messages sent and not yet delivered. idle is closed
+	// when there is no in-flight message.
+	flightMu sync.Mutex
+	inFlight int
+	idle     chan struct{}
+}
+
+// NewAsyncProducer creates an asynchronous producer. It returns
+// ValidationErrors if the configurations are invalid.
+func NewAsyncProducer(cfg ProducerConfig) (AsyncProducer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Return.Errors = true
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the producer client: %w", err)
+	}
+	p, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("unable to create the producer: %w", err)
+	}
+	return newAsyncProducer(cfg, client, p), nil
+}
+
+func newAsyncProducer(cfg ProducerConfig, client sarama.Client, p sarama.AsyncProducer) *asyncProducer {
+	ap := &asyncProducer{
+		client:   client,
+		producer: p,
+		cfg:      cfg,
+		metrics:  newProducerMetrics(cfg.Metrics),
+		reports:  make(chan DeliveryReport, reportsBufferSize),
+		idle:     make(chan struct{}),
+	}
+	close(ap.idle)
+	ap.wg.Add(2)
+	go func() {
+		defer ap.wg.Done()
+		for msg := range p.Successes() {
+			ap.deliver(msg, nil)
+		}
+	}()
+	go func() {
+		defer ap.wg.Done()
+		for err := range p.Errors() {
+			ap.deliver(err.Msg, err.Err)
+		}
+	}()
+	return ap
+}
+
+// Send produces the message and calls callback once it is delivered or failed.
+func (p *asyncProducer) Send(msg *sarama.ProducerMessage, callback DeliveryCallback) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		// Reports is closed with the producer, only the callback is called.
+		if callback != nil {
+			callback(DeliveryReport{Message: msg, Partition: -1, Offset: -1, Err: ErrProducerClosed})
+		}
+		return
+	}
+	p.track()
+	msg.Metadata = &delivery{metadata: msg.Metadata, callback: callback, sent: time.Now()}
+	p.producer.Input() <- msg
+}
+
+// SendFuture produces the message and returns the future of its delivery.
+func (p *asyncProducer) SendFuture(msg *sarama.ProducerMessage) *DeliveryFuture {
+	f := &DeliveryFuture{done: make(chan struct{})}
+	p.Send(msg, func(report DeliveryReport) {
+		f.report = report
+		close(f.done)
+	})
+	return f
+}
+
+// Reports returns the deliveries of the messages sent without callback.
+func (p *asyncProducer) Reports() <-chan DeliveryReport {
+	return p.reports
+}
+
+// track adds an in-flight message.
+func (p *asyncProducer) track() {
+	p.flightMu.Lock()
+	defer p.flightMu.Unlock()
+	if p.inFlight == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.inFlight++
+}
+
+// deliver reports the result of a sent message.
+func (p *asyncProducer) deliver(msg *sarama.ProducerMessage, err error) {
+	d, _ := msg.Metadata.(*delivery)
+	report := DeliveryReport{Message: msg, Partition: msg.Partition, Offset: msg.Offset, Err: err}
+	if err != nil {
+		report.Partition, report.Offset = -1, -1
+		p.metrics.sendFailures.Inc(msg.Topic)
+	}
+	var callback DeliveryCallback
+	if d != nil {
+		msg.Metadata = d.metadata
+		callback = d.callback
+		p.metrics.sendDuration.Observe(time.Since(d.sent).Seconds(), msg.Topic)
+	}
+	p.report(report, callback)
+
+	p.flightMu.Lock()
+	defer p.flightMu.Unlock()
+	p.inFlight--
+	if p.inFlight == 0 {
+		close(p.idle)
+	}
+}
+
+func (p *asyncProducer) report(report DeliveryReport, callback DeliveryCallback) {
+	switch {
+	case callback != nil:
+		callback(report)
+	case p.cfg.ReturnReports:
+		p.reports <- report
+	case report.Err != nil:
+		p.cfg.Logger.WithError(report.Err).Errorf("Unable to produce the message. topic = %s", report.Message.Topic)
+	}
+}
+
+// Flush waits until all the sent messages are delivered or failed, or ctx is done.
+func (p *asyncProducer) Flush(ctx context.Context) error {
+	p.flightMu.Lock()
+	idle := p.idle
+	p.flightMu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close waits for the sent messages and closes the producer.
+func (p *asyncProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	// The results are drained by the delivery goroutines, which return once
+	// the producer has flushed the sent messages.
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	close(p.reports)
+	if p.client == nil {
+		return nil
+	}
+	return p.client.Close()
+}
+
+// Ready returns an error if the controller broker can not be reached.
+func (p *asyncProducer) Ready(ctx context.Context) error {
+	return clientReady(ctx, p.client)
+}
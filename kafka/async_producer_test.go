@@ -0,0 +1,121 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+func newTestAsyncProducer(t *testing.T, returnReports bool) (*asyncProducer, *mocks.AsyncProducer) {
+	cfg := ProducerConfig{
+		ClientConfig:  ClientConfig{Brokers: []string{"localhost:9092"}, Metrics: metrics.NewRegistry()},
+		ReturnReports: returnReports,
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	mock := mocks.NewAsyncProducer(t, config)
+	return newAsyncProducer(cfg, nil, mock), mock
+}
+
+func TestAsyncProducer_Callback(t *testing.T) {
+	p, mock := newTestAsyncProducer(t, false)
+	failure := errors.New("broker not available")
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(failure)
+
+	var mu sync.Mutex
+	var reports []DeliveryReport
+	callback := func(report DeliveryReport) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, report)
+	}
+	p.Send(&sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("a"), Metadata: "a"}, callback)
+	p.Send(&sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("b"), Metadata: "b"}, callback)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 reports, got %d", len(reports))
+	}
+	for _, report := range reports {
+		switch report.Message.Metadata {
+		case "a":
+			if report.Err != nil {
+				t.Errorf("Expected message a to be delivered, got %s", report.Err)
+			}
+		case "b":
+			if !errors.Is(report.Err, failure) || report.Offset != -1 {
+				t.Errorf("Expected message b to fail, got %+v", report)
+			}
+		default:
+			t.Errorf("Expected the metadata of the message to be restored, got %v", report.Message.Metadata)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+}
+
+func TestAsyncProducer_Future(t *testing.T) {
+	p, mock := newTestAsyncProducer(t, false)
+	mock.ExpectInputAndSucceed()
+	future := p.SendFuture(&sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("a")})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, _, err := future.Wait(ctx); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+
+	closed := p.SendFuture(&sarama.ProducerMessage{Topic: "orders"})
+	if _, _, err := closed.Wait(ctx); !errors.Is(err, ErrProducerClosed) {
+		t.Errorf("Expected ErrProducerClosed, got %v", err)
+	}
+}
+
+func TestAsyncProducer_Reports(t *testing.T) {
+	p, mock := newTestAsyncProducer(t, true)
+	for i := 0; i < 3; i++ {
+		mock.ExpectInputAndSucceed()
+		p.Send(&sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("a")}, nil)
+	}
+	// Close waits for the sent messages, the reports are read afterwards.
+	if err := p.Close(); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+	var delivered int
+	for report := range p.Reports() {
+		if report.Err != nil {
+			t.Errorf("Found error %s", report.Err)
+		}
+		delivered++
+	}
+	if delivered != 3 {
+		t.Errorf("Expected 3 reports, got %d", delivered)
+	}
+}
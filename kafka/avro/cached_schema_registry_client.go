@@ -10,6 +10,12 @@ import (
 	"sync"
 
 	"github.com/linkedin/goavro/v2"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+const (
+	codecCache = "codec"
+	idCache    = "id"
 )
 
 type cachedSchemaRegistryClient struct {
@@ -17,13 +23,31 @@ type cachedSchemaRegistryClient struct {
 	codecs       map[int]*goavro.Codec
 	ids          map[string]int
 	mu           sync.RWMutex
+	hits         *metrics.Counter
+	misses       *metrics.Counter
 }
 
+// NewCachedSchemaRegistry creates a schema registry client caching the schemas
+// and their ids. The cache metrics are published to metrics.DefaultRegistry.
 func NewCachedSchemaRegistry(urls []string, retries int) SchemaRegistry {
+	return NewCachedSchemaRegistryWithMetrics(urls, retries, nil)
+}
+
+// NewCachedSchemaRegistryWithMetrics creates a schema registry client caching
+// the schemas and their ids, publishing the cache metrics to the given
+// registry. metrics.DefaultRegistry is used if registry is nil.
+func NewCachedSchemaRegistryWithMetrics(urls []string, retries int, registry *metrics.Registry) SchemaRegistry {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
 	return &cachedSchemaRegistryClient{
 		nativeClient: NewSchemaRegistry(urls, retries),
 		codecs:       make(map[int]*goavro.Codec),
 		ids:          make(map[string]int),
+		hits: registry.Counter("sterna_avro_schema_cache_hits_total",
+			"Number of schema registry lookups served from the cache.", "cache"),
+		misses: registry.Counter("sterna_avro_schema_cache_misses_total",
+			"Number of schema registry lookups sent to the registry.", "cache"),
 	}
 }
 
@@ -32,8 +56,10 @@ func (client *cachedSchemaRegistryClient) GetSchema(id int) (*goavro.Codec, erro
 	cachedResult, ok := client.codecs[id]
 	client.mu.RUnlock()
 	if ok {
+		client.hits.Inc(codecCache)
 		return cachedResult, nil
 	}
+	client.misses.Inc(codecCache)
 	result, err := client.nativeClient.GetSchema(id)
 	if err != nil {
 		return nil, err
@@ -66,8 +92,10 @@ func (client *cachedSchemaRegistryClient) CreateSubject(subject string, codec *g
 	cachedResult, ok := client.ids[schemaJson]
 	client.mu.RUnlock()
 	if ok {
+		client.hits.Inc(idCache)
 		return cachedResult, nil
 	}
+	client.misses.Inc(idCache)
 
 	id, err := client.nativeClient.CreateSubject(subject, codec)
 	if err != nil {
@@ -0,0 +1,49 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package avro
+package avro
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/udayangaac/sterna/metrics"
+)
+
+func TestCachedSchemaRegistry_Metrics(t *testing.T) {
+	count := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, `{"schema": "\"string\""}`)
+	}))
+	defer mockServer.Close()
+	registry := metrics.NewRegistry()
+	client := NewCachedSchemaRegistryWithMetrics([]string{mockServer.URL}, 0, registry)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetSchema(1); err != nil {
+			t.Fatalf("Found error %s", err)
+		}
+	}
+	if count != 1 {
+		t.Errorf("Expected the schema to be fetched once, got %d", count)
+	}
+
+	buf := &bytes.Buffer{}
+	_ = registry.WriteText(buf)
+	for _, expected := range []string{
+		`sterna_avro_schema_cache_hits_total{cache="codec"} 1`,
+		`sterna_avro_schema_cache_misses_total{cache="codec"} 1`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected %s, got\n%s", expected, buf)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package avro
+package avro
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReadinessCheck creates a readiness check which lists the subjects of the schema registry.
+func ReadinessCheck(registry SchemaRegistry) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := registry.GetSubjects()
+			errCh <- err
+		}()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return fmt.Errorf("schema registry is not reachable: %w", err)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// BatchError reports the messages of a batch which failed, by their index in
+// the batch. The other messages of the batch are committed.
+type BatchError struct {
+	Errors map[int]error
+}
+
+// NewBatchError creates an empty batch error.
+func NewBatchError() *BatchError {
+	return &BatchError{Errors: make(map[int]error)}
+}
+
+// Add reports the failure of the message at index i of the batch.
+func (e *BatchError) Add(i int, err error) {
+	e.Errors[i] = err
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	msgs := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		msgs = append(msgs, fmt.Sprintf("message %d: %s", i, e.Errors[i]))
+	}
+	return "batch failed: " + strings.Join(msgs, ", ")
+}
+
+// consumeBatches collects the messages of the claim in batches and calls the
+// batch callback. Offsets are marked after the batch is handled.
+func (c *ConsumerGroupHandler) consumeBatches(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	batch := make([]*sarama.ConsumerMessage, 0, c.cfg.BatchSize)
+	var window <-chan time.Time
+	var timer *time.Timer
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, window = nil, nil
+		}
+		if len(batch) > 0 {
+			c.processBatch(session, batch)
+			batch = batch[:0]
+		}
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				flush()
+				return nil
+			}
+			if due, ok := dueTime(message); ok && time.Until(due) > 0 {
+				// Handle the collected messages before waiting for the retried one.
+				flush()
+			}
+			if !c.waitUntilDue(session.Context(), message) {
+				return nil
+			}
+			batch = append(batch, message)
+			if len(batch) >= c.cfg.BatchSize {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(c.cfg.BatchWindow)
+				window = timer.C
+			}
+		case <-window:
+			timer, window = nil, nil
+			flush()
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// processBatch decodes the messages and calls the batch callback. Failed
+// messages are handled one by one like the failures of Handler.
+func (c *ConsumerGroupHandler) processBatch(session sarama.ConsumerGroupSession, batch []*sarama.ConsumerMessage) {
+	ctx := session.Context()
+	mark := c.marker(session)
+	commit := make([]bool, len(batch))
+	decoded := make([]*Message, 0, len(batch))
+	positions := make([]int, 0, len(batch))
+	for i, message := range batch {
+		msg, err := c.decode(message, mark)
+		if err != nil {
+			commit[i] = c.handleFailure(ctx, msg, err)
+			continue
+		}
+		decoded = append(decoded, msg)
+		positions = append(positions, i)
+	}
+
+	if len(decoded) > 0 {
+		err := c.cfg.BatchCallback(ctx, decoded)
+		var batchErr *BatchError
+		partial := errors.As(err, &batchErr)
+		for i, msg := range decoded {
+			msgErr := err
+			if partial {
+				msgErr = batchErr.Errors[i]
+			}
+			if msgErr == nil {
+				commit[positions[i]] = c.cfg.CommitMode != CommitManual
+				continue
+			}
+			c.metrics.callbackErrors.Inc(msg.ConsumedTopic, partitionLabel(msg.Partition))
+			commit[positions[i]] = c.handleFailure(ctx, msg, msgErr)
+		}
+	}
+
+	for i, message := range batch {
+		if commit[i] {
+			c.committer.mark(session, message)
+		}
+	}
+}
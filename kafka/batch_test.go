@@ -0,0 +1,88 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestConsumerGroupHandler_Batch(t *testing.T) {
+	var batches [][]string
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.BatchSize = 2
+	cfg.BatchCallback = func(ctx context.Context, messages []*Message) error {
+		var values []string
+		batchErr := NewBatchError()
+		for i, msg := range messages {
+			values = append(values, msg.Value.(string))
+			if msg.Value == "bad" {
+				batchErr.Add(i, errors.New("unable to write"))
+			}
+		}
+		batches = append(batches, values)
+		if len(batchErr.Errors) > 0 {
+			return batchErr
+		}
+		return nil
+	}
+	producer := &mockProducer{}
+	cfg.DeadLetter = &DeadLetterPolicy{Producer: producer}
+	session := newMockSession()
+	if err := getConsumerGroupHandler(cfg).ConsumeClaim(session, newMockClaim("orders", 0, "a", "bad", "c")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	expected := [][]string{{"a", "bad"}, {"c"}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("Expected batches %v, got %v", expected, batches)
+	}
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 2, 3}) {
+		t.Errorf("Expected offsets [1 2 3] to be committed, got %v", session.markedOffsets())
+	}
+	if len(producer.messages) != 1 || producer.messages[0].Topic != "orders.dlq" {
+		t.Errorf("Expected the failed message to be dead-lettered, got %v", producer.messages)
+	}
+}
+
+func TestConsumerGroupHandler_BatchWindow(t *testing.T) {
+	batches := make(chan int, 2)
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.BatchSize = 10
+	cfg.BatchWindow = 10 * time.Millisecond
+	cfg.BatchCallback = func(ctx context.Context, messages []*Message) error {
+		batches <- len(messages)
+		return errors.New("sink unavailable")
+	}
+	cfg.ConsumerErrorHandler = func(err error) bool { return false }
+	claim := &mockClaim{topic: "orders", messages: make(chan *sarama.ConsumerMessage, 1)}
+	session := newMockSession()
+	done := make(chan error, 1)
+	go func() { done <- getConsumerGroupHandler(cfg).ConsumeClaim(session, claim) }()
+
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Value: []byte("a")}
+	select {
+	case n := <-batches:
+		if n != 1 {
+			t.Errorf("Expected a batch of 1 message, got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the batch to be flushed after the window")
+	}
+	close(claim.messages)
+	if err := <-done; err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if len(session.markedOffsets()) != 0 {
+		t.Errorf("Expected no offsets committed, got %v", session.markedOffsets())
+	}
+}
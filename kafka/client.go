@@ -0,0 +1,201 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/log"
+	"github.com/udayangaac/sterna/metrics"
+	"github.com/xdg-go/scram"
+)
+
+// SASLMechanism SASL mechanism used to authenticate to the brokers.
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = "PLAIN"
+	SASLScramSHA256 SASLMechanism = "SCRAM-SHA-256"
+	SASLScramSHA512 SASLMechanism = "SCRAM-SHA-512"
+)
+
+// TLSConfig TLS configurations of the connections to the brokers.
+type TLSConfig struct {
+	// CAFile PEM file of the certificate authorities. The system pool is used if not set.
+	CAFile string
+	// CertFile and KeyFile PEM files of the client certificate, for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify skips the verification of the broker certificates.
+	// Only use it in development.
+	InsecureSkipVerify bool
+}
+
+// build creates the tls.Config.
+func (t *TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify} // #nosec G402 -- opt-in for development
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA file %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// SASLConfig SASL authentication of the connections to the brokers.
+type SASLConfig struct {
+	Mechanism SASLMechanism
+	Username  string
+	Password  string
+}
+
+// apply enables the SASL authentication in the sarama configurations.
+func (s *SASLConfig) apply(config *sarama.Config) error {
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.User = s.Username
+	config.Net.SASL.Password = s.Password
+	switch s.Mechanism {
+	case SASLPlain, "":
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLScramSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.HashGeneratorFcn(sha256.New)}
+		}
+	case SASLScramSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.HashGeneratorFcn(sha512.New)}
+		}
+	default:
+		return fmt.Errorf("invalid SASL mechanism: %s", s.Mechanism)
+	}
+	return nil
+}
+
+// scramClient sarama.SCRAMClient implementation.
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
+
+// ClientConfig configurations shared by the consumers, the producers and the
+// admin clients.
+type ClientConfig struct {
+	Brokers []string
+	Version Version
+	// ClientID client id sent to the brokers. Defaults to the sarama one.
+	ClientID string
+	// TLS enables TLS for the connections to the brokers.
+	TLS *TLSConfig
+	// SASL enables the SASL authentication to the brokers.
+	SASL     *SASLConfig
+	Logger   log.Logger
+	LogLevel log.Level
+	// Metrics registry of the kafka metrics. metrics.DefaultRegistry is used if not set.
+	Metrics *metrics.Registry
+}
+
+// validate verifies the client configurations and sets the default logger
+// and metrics registry.
+func (c *ClientConfig) validate() (errs ValidationErrors) {
+	if c.Logger == nil {
+		ll := log.Info
+		if c.LogLevel != "" {
+			ll = c.LogLevel
+		}
+		conf := log.NewConfig()
+		conf.WithLogLevel(ll)
+		c.Logger = log.NewZeroLogger(conf)
+	}
+	if c.Metrics == nil {
+		c.Metrics = metrics.DefaultRegistry
+	}
+	if len(c.Brokers) == 0 {
+		errs.add("Brokers", "at least one broker is required")
+	}
+	if c.Version != "" {
+		if _, err := sarama.ParseKafkaVersion(string(c.Version)); err != nil {
+			errs.add("Version", "%s", err)
+		}
+	}
+	if c.SASL != nil {
+		switch c.SASL.Mechanism {
+		case "", SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		default:
+			errs.add("SASL.Mechanism", "unknown mechanism %q", c.SASL.Mechanism)
+		}
+	}
+	return
+}
+
+// saramaConfig creates the sarama configurations with the client settings.
+// The version is left to the sarama default if not set.
+func (c *ClientConfig) saramaConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	if c.Version != "" {
+		version, err := sarama.ParseKafkaVersion(string(c.Version))
+		if err != nil {
+			return nil, err
+		}
+		config.Version = version
+	}
+	if c.ClientID != "" {
+		config.ClientID = c.ClientID
+	}
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	if c.SASL != nil {
+		if err := c.SASL.apply(config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir.
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sterna"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestConsumerConfig_SaramaConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	cfg := ConsumerConfig{
+		ClientConfig: ClientConfig{
+			Version:  Version_2_1_1,
+			ClientID: "orders",
+			TLS: &TLSConfig{
+				CAFile:   certFile,
+				CertFile: certFile,
+				KeyFile:  keyFile,
+			},
+			SASL: &SASLConfig{
+				Mechanism: SASLScramSHA512,
+				Username:  "orders",
+				Password:  "secret",
+			},
+		},
+		SessionTimeout:    20 * time.Second,
+		HeartbeatInterval: 5 * time.Second,
+		RebalanceTimeout:  time.Minute,
+		FetchMinBytes:     1024,
+		FetchMaxBytes:     1 << 20,
+		MaxProcessingTime: 2 * time.Second,
+		ChannelBufferSize: 512,
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err = config.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, found error %s", err)
+	}
+	if config.Version.String() != "2.1.1" {
+		t.Errorf("Expected version 2.1.1, got %s", config.Version)
+	}
+	if config.ClientID != "orders" {
+		t.Errorf("Expected client id orders, got %s", config.ClientID)
+	}
+	if !config.Net.TLS.Enable || config.Net.TLS.Config.RootCAs == nil || len(config.Net.TLS.Config.Certificates) != 1 {
+		t.Errorf("Expected TLS with the CA and the client certificate, got %+v", config.Net.TLS)
+	}
+	if !config.Net.SASL.Enable || config.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 || config.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Errorf("Expected SCRAM-SHA-512, got %+v", config.Net.SASL)
+	}
+	if config.Consumer.Group.Session.Timeout != 20*time.Second ||
+		config.Consumer.Group.Heartbeat.Interval != 5*time.Second ||
+		config.Consumer.Group.Rebalance.Timeout != time.Minute {
+		t.Errorf("Expected the group timeouts to be applied, got %+v", config.Consumer.Group)
+	}
+	if config.Consumer.Fetch.Min != 1024 || config.Consumer.Fetch.Max != 1<<20 {
+		t.Errorf("Expected the fetch bounds to be applied, got %+v", config.Consumer.Fetch)
+	}
+	if config.Consumer.MaxProcessingTime != 2*time.Second || config.ChannelBufferSize != 512 {
+		t.Errorf("Expected the processing settings to be applied, got %s and %d",
+			config.Consumer.MaxProcessingTime, config.ChannelBufferSize)
+	}
+
+	client := config.Net.SASL.SCRAMClientGeneratorFunc()
+	if err = client.Begin("orders", "secret", ""); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if first, err := client.Step(""); err != nil || first == "" {
+		t.Errorf("Expected the client first message, got %q %v", first, err)
+	}
+}
+
+func TestClientConfig_SaramaConfigErrors(t *testing.T) {
+	tests := map[string]ClientConfig{
+		"missing CA file":  {TLS: &TLSConfig{CAFile: filepath.Join(t.TempDir(), "ca.pem")}},
+		"missing key file": {TLS: &TLSConfig{CertFile: "cert.pem"}},
+		"unknown SASL":     {SASL: &SASLConfig{Mechanism: "GSSAPI"}},
+		"invalid version":  {Version: "x.y"},
+	}
+	for name, cfg := range tests {
+		if _, err := cfg.saramaConfig(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// CommitMode how the offsets of the consumed messages are committed. All the
+// modes are at-least-once: an offset is only marked after its message is
+// handled, so messages handled after the last commit are redelivered after a
+// crash.
+type CommitMode string
+
+const (
+	// CommitAuto marks the messages after they are handled and lets sarama
+	// commit the marked offsets periodically.
+	CommitAuto CommitMode = "auto"
+	// CommitSync marks the messages after they are handled and commits
+	// synchronously every CommitEvery messages or CommitInterval, and when
+	// the session ends.
+	CommitSync CommitMode = "sync"
+	// CommitManual marks a message only when Message.Ack is called by the
+	// handler. Acknowledging a message commits all the earlier offsets of its
+	// partition. Offsets are committed synchronously like CommitSync.
+	CommitManual CommitMode = "manual"
+
+	defaultCommitEvery    = 100
+	defaultCommitInterval = time.Second
+)
+
+// committer marks the offsets and commits them according to the commit mode.
+type committer struct {
+	mode     CommitMode
+	every    int
+	interval time.Duration
+	marked   int
+	last     time.Time
+	mu       sync.Mutex
+}
+
+func newCommitter(cfg ConsumerConfig) *committer {
+	return &committer{mode: cfg.CommitMode, every: cfg.CommitEvery, interval: cfg.CommitInterval, last: time.Now()}
+}
+
+// mark marks the message as consumed and commits when due.
+func (c *committer) mark(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) {
+	session.MarkMessage(message, "")
+	if c.mode == CommitAuto {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marked++
+	if c.marked >= c.every || time.Since(c.last) >= c.interval {
+		c.commitLocked(session)
+	}
+}
+
+// commit commits the marked offsets synchronously.
+func (c *committer) commit(session sarama.ConsumerGroupSession) {
+	if c.mode == CommitAuto {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commitLocked(session)
+}
+
+func (c *committer) commitLocked(session sarama.ConsumerGroupSession) {
+	if c.marked > 0 {
+		session.Commit()
+	}
+	c.marked = 0
+	c.last = time.Now()
+}
+
+// run commits the marked offsets every interval until the session ends, so
+// the offsets of idle partitions are committed too.
+func (c *committer) run(session sarama.ConsumerGroupSession) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-session.Context().Done():
+			return
+		case <-ticker.C:
+			c.commit(session)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// consumeSession runs a whole session of the handler over the given values.
+func consumeSession(t *testing.T, cfg ConsumerConfig, values ...string) *mockSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := newMockSession()
+	session.ctx = ctx
+	handler := getConsumerGroupHandler(cfg)
+	if err := handler.Setup(session); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err := handler.ConsumeClaim(session, newMockClaim("orders", 0, values...)); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err := handler.Cleanup(session); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	return session
+}
+
+func failingOn(bad string) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		if msg.Value == bad {
+			return errors.New("unable to process")
+		}
+		return nil
+	}
+}
+
+func TestCommitMode_Auto(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Handler = failingOn("b")
+	cfg.ConsumerErrorHandler = func(err error) bool { return false }
+	session := consumeSession(t, cfg, "a", "b")
+
+	// The failed message is not marked, sarama commits the marked offsets.
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1}) {
+		t.Errorf("Expected offset 1 to be marked, got %v", session.markedOffsets())
+	}
+	if len(session.committed) != 0 {
+		t.Errorf("Expected no synchronous commits, got %v", session.committed)
+	}
+}
+
+func TestCommitMode_Sync(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.CommitMode = CommitSync
+	cfg.CommitEvery = 2
+	cfg.CommitInterval = time.Hour
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	cfg.Handler = failingOn("d")
+	cfg.ConsumerErrorHandler = func(err error) bool { return false }
+	session := consumeSession(t, cfg, "a", "b", "c", "d")
+
+	// Committed after every 2 handled messages and when the session ends.
+	expected := [][]int64{{1, 2}, {1, 2, 3}}
+	if !reflect.DeepEqual(session.committed, expected) {
+		t.Errorf("Expected commits %v, got %v", expected, session.committed)
+	}
+}
+
+func TestCommitMode_Manual(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.CommitMode = CommitManual
+	cfg.CommitInterval = time.Hour
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		if msg.Value != "b" {
+			msg.Ack()
+		}
+		return nil
+	}
+	session := consumeSession(t, cfg, "a", "b", "c")
+
+	// Handled messages are only marked when acknowledged.
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 3}) {
+		t.Errorf("Expected offsets [1 3] to be marked, got %v", session.markedOffsets())
+	}
+	if !reflect.DeepEqual(session.committed, [][]int64{{1, 3}}) {
+		t.Errorf("Expected the offsets to be committed when the session ends, got %v", session.committed)
+	}
+	// Kafka keeps a single offset per partition: acknowledging c commits
+	// offset 3, so b is not consumed again although it was not acknowledged.
+	if last := session.committed[len(session.committed)-1]; last[len(last)-1] != 3 {
+		t.Errorf("Expected the partition to be committed up to offset 3, got %v", last)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// workerQueueSize number of messages queued per worker, so that a slow key
+// does not block the dispatching of the other keys immediately.
+const workerQueueSize = 16
+
+// consumeConcurrently dispatches the messages of the claim to
+// ConsumerConfig.Concurrency workers by the hash of their key. Messages with the same
+// key are processed in order by the same worker. Offsets are marked in order,
+// once all the earlier messages of the partition are processed, including the
+// ones acknowledged in the CommitManual mode.
+func (c *ConsumerGroupHandler) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker(c.marker(session))
+	workers := make([]chan *sarama.ConsumerMessage, c.cfg.Concurrency)
+	wg := sync.WaitGroup{}
+	for i := range workers {
+		workers[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+		wg.Add(1)
+		go func(messages <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for message := range messages {
+				tracker.done(message, c.process(session, message, tracker.ack))
+			}
+		}(workers[i])
+	}
+	defer func() {
+		for _, worker := range workers {
+			close(worker)
+		}
+		wg.Wait()
+	}()
+
+	for message := range claim.Messages() {
+		if !c.waitUntilDue(session.Context(), message) {
+			return nil
+		}
+		tracker.add(message)
+		workers[workerIndex(message, len(workers))] <- message
+	}
+	return nil
+}
+
+// workerIndex returns the worker of the message. Messages without a key have
+// no ordering to preserve and are spread by offset.
+func workerIndex(message *sarama.ConsumerMessage, workers int) int {
+	if len(message.Key) == 0 {
+		return int(message.Offset % int64(workers))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(message.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// offsetTracker marks the offsets of the messages processed out of order once
+// every earlier message of the partition is processed.
+type offsetTracker struct {
+	mark func(message *sarama.ConsumerMessage)
+	// pending messages in offset order, from the oldest one not processed.
+	pending  []*trackedMessage
+	byOffset map[int64]*trackedMessage
+	mu       sync.Mutex
+}
+
+type trackedMessage struct {
+	message *sarama.ConsumerMessage
+	done    bool
+	commit  bool
+}
+
+func newOffsetTracker(mark func(message *sarama.ConsumerMessage)) *offsetTracker {
+	return &offsetTracker{mark: mark, byOffset: make(map[int64]*trackedMessage)}
+}
+
+// add tracks the message before it is dispatched.
+func (t *offsetTracker) add(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := &trackedMessage{message: message}
+	t.pending = append(t.pending, m)
+	t.byOffset[message.Offset] = m
+}
+
+// ack records the acknowledgement of the message in the CommitManual mode. It
+// is marked once every earlier message of the partition is processed.
+func (t *offsetTracker) ack(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m, ok := t.byOffset[message.Offset]; ok {
+		m.commit = true
+		return
+	}
+	// The message is no longer pending, every earlier message is processed.
+	t.mark(message)
+}
+
+// done records the processed message and marks the offsets of the processed
+// messages which have no earlier message pending.
+func (t *offsetTracker) done(message *sarama.ConsumerMessage, commit bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m, ok := t.byOffset[message.Offset]
+	if !ok {
+		return
+	}
+	m.done, m.commit = true, m.commit || commit
+	for len(t.pending) > 0 && t.pending[0].done {
+		m = t.pending[0]
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+		delete(t.byOffset, m.message.Offset)
+		if m.commit {
+			t.mark(m.message)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	session := newMockSession()
+	tracker := newOffsetTracker(func(message *sarama.ConsumerMessage) {
+		session.MarkMessage(message, "")
+	})
+	messages := make([]*sarama.ConsumerMessage, 4)
+	for i := range messages {
+		messages[i] = &sarama.ConsumerMessage{Topic: "orders", Offset: int64(i)}
+		tracker.add(messages[i])
+	}
+	tracker.done(messages[2], true)
+	tracker.done(messages[1], false)
+	if len(session.markedOffsets()) != 0 {
+		t.Errorf("Expected no offsets marked before offset 0 completes, got %v", session.markedOffsets())
+	}
+	tracker.done(messages[0], true)
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 3}) {
+		t.Errorf("Expected offsets [1 3] to be marked, got %v", session.markedOffsets())
+	}
+	tracker.done(messages[3], true)
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 3, 4}) {
+		t.Errorf("Expected offsets [1 3 4] to be marked, got %v", session.markedOffsets())
+	}
+}
+
+func TestConsumerGroupHandler_Concurrency(t *testing.T) {
+	const messages = 100
+	received := make(map[string][]int64)
+	mu := sync.Mutex{}
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Concurrency = 4
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		if msg.Offset%7 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		key := string(msg.RawKey)
+		received[key] = append(received[key], msg.Offset)
+		return nil
+	}
+	claim := &mockClaim{topic: "orders", messages: make(chan *sarama.ConsumerMessage, messages)}
+	for i := 0; i < messages; i++ {
+		claim.messages <- &sarama.ConsumerMessage{
+			Topic:  "orders",
+			Offset: int64(i),
+			Key:    []byte(fmt.Sprintf("key-%d", i%10)),
+			Value:  []byte("a"),
+		}
+	}
+	close(claim.messages)
+
+	session := newMockSession()
+	if err := getConsumerGroupHandler(cfg).ConsumeClaim(session, claim); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	for key, offsets := range received {
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Fatalf("Expected messages of %s in order, got %v", key, offsets)
+			}
+		}
+	}
+	marked := session.markedOffsets()
+	if len(marked) != messages {
+		t.Fatalf("Expected %d offsets marked, got %d", messages, len(marked))
+	}
+	for i, offset := range marked {
+		if offset != int64(i+1) {
+			t.Fatalf("Expected offsets to be marked in order, got %v", marked)
+		}
+	}
+}
+
+func TestConsumerGroupHandler_ConcurrencyManualAck(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Concurrency = 2
+	cfg.CommitMode = CommitManual
+	release, acked := make(chan struct{}), make(chan struct{})
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		// The keys are processed by different workers.
+		if msg.Value == "slow" {
+			<-release
+		}
+		msg.Ack()
+		if msg.Value == "fast" {
+			close(acked)
+		}
+		return nil
+	}
+	session := newMockSession()
+	done := make(chan error, 1)
+	go func() {
+		done <- getConsumerGroupHandler(cfg).ConsumeClaim(session, newMockClaim("orders", 0, "slow", "fast"))
+	}()
+
+	<-acked
+	// The acknowledged message is not marked while an earlier one is in flight.
+	if marked := session.markedOffsets(); len(marked) != 0 {
+		t.Errorf("Expected no offset to be marked, got %v", marked)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 2}) {
+		t.Errorf("Expected offsets [1 2] to be marked, got %v", session.markedOffsets())
+	}
+}
@@ -7,7 +7,9 @@
 package kafka
 
 import (
-	"github.com/udayangaac/sterna/log"
+	"time"
+
+	"github.com/Shopify/sarama"
 )
 
 const (
@@ -19,40 +21,229 @@ const (
 
 	Newest Offset = "newest"
 	Oldest Offset = "oldest"
+
+	ReadUncommitted IsolationLevel = "read_uncommitted"
+	ReadCommitted   IsolationLevel = "read_committed"
+
+	defaultRejoinBackoff       = time.Second
+	defaultMaxRejoinBackoff    = 30 * time.Second
+	defaultRepublishBackoff    = time.Second
+	defaultMaxRepublishBackoff = 30 * time.Second
+	defaultBatchSize           = 100
+	defaultBatchWindow         = time.Second
 )
 
-// Config General configurations.
-type Config struct {
-	Brokers              []string
-	Group                string
-	Version              Version
-	Topics               []string
-	BalanceStrategy      BalanceStrategy
-	Offset               Offset
-	Logger               log.Logger
-	LogLevel             log.Level
-	EncoderBuilder       EncoderBuilder
-	Decoder              Decoder
-	ConsumerCallback     ConsumerCallback
+// IsolationLevel which messages of the transactions are consumed.
+type IsolationLevel string
+
+// Config consumer configurations.
+//
+// Deprecated: use ConsumerConfig.
+type Config = ConsumerConfig
+
+// ConsumerConfig configurations of the consumer groups.
+type ConsumerConfig struct {
+	ClientConfig
+	// SessionTimeout, HeartbeatInterval and RebalanceTimeout timeouts of the
+	// consumer group membership. The sarama defaults are used if not set.
+	SessionTimeout    time.Duration
+	HeartbeatInterval time.Duration
+	RebalanceTimeout  time.Duration
+	// FetchMinBytes and FetchMaxBytes bounds of the fetch requests.
+	FetchMinBytes int32
+	FetchMaxBytes int32
+	// MaxProcessingTime time a message may take to be handled before the
+	// partition stops being fetched.
+	MaxProcessingTime time.Duration
+	// ChannelBufferSize number of messages buffered in the internal channels.
+	ChannelBufferSize int
+	// IsolationLevel ReadCommitted skips the messages of aborted transactions.
+	// Defaults to ReadUncommitted, or ReadCommitted with Transactional.
+	IsolationLevel IsolationLevel
+
+	Group            string
+	Topics           []string
+	BalanceStrategy  BalanceStrategy
+	Offset           Offset
+	Decoder          Decoder
+	ConsumerCallback ConsumerCallback
+	// Handler receives the messages with their metadata. ConsumerCallback is
+	// adapted to a Handler if Handler is not set.
+	Handler Handler
+	// Middlewares wrap the Handler, the first one being the outermost. Use
+	// ConsumerConfig.Use to add them.
+	Middlewares          []Middleware
 	ConsumerErrorHandler ConsumerErrorHandler
+	// DeadLetter republishes the messages which could not be decoded or
+	// handled to a dead-letter topic instead of calling ConsumerErrorHandler.
+	DeadLetter *DeadLetterPolicy
+	// Retry republishes the failed messages to retry topics with tiered
+	// delays before they are dead-lettered.
+	Retry *RetryPolicy
+	// RepublishBackoff initial delay before publishing a message to a retry or
+	// dead-letter topic again after a failure. It doubles after each failure
+	// up to MaxRepublishBackoff. Defaults to 1s and 30s.
+	RepublishBackoff    time.Duration
+	MaxRepublishBackoff time.Duration
+	// Dedup skips the messages which were already processed. It is not
+	// applied to the BatchCallback.
+	Dedup *DedupPolicy
+	// Concurrency number of workers processing the messages of each claimed
+	// partition. Messages are dispatched by the hash of their key, so the
+	// messages with the same key are processed in order. Defaults to 1, one
+	// message at a time.
+	Concurrency int
+	// BatchCallback receives the messages of each claimed partition in
+	// batches of up to BatchSize messages, or the messages which arrived
+	// within BatchWindow. It is used instead of Handler and Concurrency.
+	BatchCallback BatchConsumerCallback
+	BatchSize     int
+	BatchWindow   time.Duration
+	// CommitMode how the offsets are committed. Defaults to CommitAuto.
+	CommitMode CommitMode
+	// CommitEvery and CommitInterval number of messages and interval after
+	// which the offsets are committed in CommitSync and CommitManual modes.
+	CommitEvery    int
+	CommitInterval time.Duration
+	// Lag monitors the lag of the consumer group while it runs.
+	Lag *LagPolicy
+	// RebalanceListener is notified about partition assignments.
+	RebalanceListener RebalanceListener
+	// RejoinBackoff initial delay before joining the group again after a consume
+	// error. It doubles after each failure up to MaxRejoinBackoff.
+	RejoinBackoff    time.Duration
+	MaxRejoinBackoff time.Duration
+	// ReturnErrors reports the consumer errors through ConsumerGroup.Errors.
+	ReturnErrors bool
+	// Transactional processes the messages exactly once with a
+	// TransformHandler, which is used instead of Handler.
+	Transactional *TransactionalPolicy
+
+	// decodeMessage decodes the messages instead of Decoder when set by
+	// Router.Apply.
+	decodeMessage func(msg *Message) (key, value interface{}, err error)
+}
+
+// Use adds the middlewares wrapping the Handler. They are not applied to the
+// BatchCallback.
+func (c *ConsumerConfig) Use(middlewares ...Middleware) {
+	c.Middlewares = append(c.Middlewares, middlewares...)
 }
 
-// validate verify the configurations and set default values.
-func (c *Config) validate() {
-	if c.Logger == nil {
-		ll := log.Info
-		if c.LogLevel != "" {
-			ll = c.LogLevel
+// validate verifies the consumer configurations and sets default values.
+// It returns ValidationErrors with all the invalid fields.
+func (c *ConsumerConfig) validate() error {
+	errs := c.ClientConfig.validate()
+	if c.Version == "" {
+		errs.add("Version", "version is required")
+	}
+	if c.Group == "" {
+		errs.add("Group", "group is required")
+	}
+	if len(c.Topics) == 0 {
+		errs.add("Topics", "at least one topic is required")
+	}
+	switch c.BalanceStrategy {
+	case Sticky, RoundRobin, Range:
+	default:
+		errs.add("BalanceStrategy", "unknown strategy %q", c.BalanceStrategy)
+	}
+	switch c.Offset {
+	case "":
+		c.Offset = Newest
+	case Newest, Oldest:
+	default:
+		errs.add("Offset", "unknown offset %q", c.Offset)
+	}
+	if c.Decoder == nil {
+		errs.add("Decoder", "decoder is required")
+	}
+	if c.Handler == nil && c.ConsumerCallback == nil && c.BatchCallback == nil && c.Transactional == nil {
+		errs.add("Handler", "a Handler, ConsumerCallback, BatchCallback or Transactional is required")
+	}
+	if c.Handler == nil && c.ConsumerCallback != nil {
+		c.Handler = CallbackHandler(c.ConsumerCallback)
+	}
+	if c.DeadLetter != nil && c.DeadLetter.Producer == nil && c.Transactional == nil {
+		errs.add("DeadLetter.Producer", "producer is required")
+	}
+	if c.Retry != nil {
+		if c.Retry.Producer == nil {
+			errs.add("Retry.Producer", "producer is required")
+		}
+		if len(c.Retry.Delays) == 0 {
+			errs.add("Retry.Delays", "at least one delay is required")
+		}
+		for _, delay := range c.Retry.Delays {
+			if delay <= 0 {
+				errs.add("Retry.Delays", "delays must be positive, got %v", delay)
+				break
+			}
+		}
+		if c.Retry.MaxAttempts <= 0 {
+			c.Retry.MaxAttempts = len(c.Retry.Delays) + 1
+		}
+	}
+	if c.Dedup != nil {
+		if c.Dedup.Store == nil {
+			errs.add("Dedup.Store", "store is required")
+		}
+		if c.Dedup.Key == nil {
+			errs.add("Dedup.Key", "key is required")
 		}
-		conf := log.NewConfig()
-		conf.WithLogLevel(ll)
-		c.Logger = log.NewZeroLogger(conf)
+		if c.Dedup.TTL <= 0 {
+			c.Dedup.TTL = defaultDedupTTL
+		}
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.BatchWindow <= 0 {
+		c.BatchWindow = defaultBatchWindow
+	}
+	switch c.CommitMode {
+	case "":
+		c.CommitMode = CommitAuto
+	case CommitAuto, CommitSync, CommitManual:
+	default:
+		errs.add("CommitMode", "unknown commit mode %q", c.CommitMode)
+	}
+	switch c.IsolationLevel {
+	case "":
+		c.IsolationLevel = ReadUncommitted
+		if c.Transactional != nil {
+			c.IsolationLevel = ReadCommitted
+		}
+	case ReadUncommitted, ReadCommitted:
+	default:
+		errs.add("IsolationLevel", "unknown isolation level %q", c.IsolationLevel)
+	}
+	if c.Transactional != nil {
+		c.Transactional.validate(c, &errs)
+	}
+	if c.CommitEvery <= 0 {
+		c.CommitEvery = defaultCommitEvery
+	}
+	if c.CommitInterval <= 0 {
+		c.CommitInterval = defaultCommitInterval
+	}
+	if c.RejoinBackoff <= 0 {
+		c.RejoinBackoff = defaultRejoinBackoff
+	}
+	if c.MaxRejoinBackoff <= 0 {
+		c.MaxRejoinBackoff = defaultMaxRejoinBackoff
+	}
+	if c.MaxRejoinBackoff < c.RejoinBackoff {
+		c.MaxRejoinBackoff = c.RejoinBackoff
 	}
-	if c.ConsumerCallback == nil {
-		c.Logger.Fatalf("Please define a consumer callback in avro.Config")
+	if c.RepublishBackoff <= 0 {
+		c.RepublishBackoff = defaultRepublishBackoff
 	}
-	if c.EncoderBuilder == nil {
-		c.Logger.Fatalf("Please define an Encoder builder")
+	if c.MaxRepublishBackoff <= 0 {
+		c.MaxRepublishBackoff = defaultMaxRepublishBackoff
+	}
+	if c.MaxRepublishBackoff < c.RepublishBackoff {
+		c.MaxRepublishBackoff = c.RepublishBackoff
 	}
 	if c.ConsumerErrorHandler == nil {
 		c.ConsumerErrorHandler = func(err error) (commitMsg bool) {
@@ -60,4 +251,38 @@ func (c *Config) validate() {
 			return true
 		}
 	}
+	return errs.err()
+}
+
+// saramaConfig creates the sarama configurations of the consumer group.
+func (c *ConsumerConfig) saramaConfig() (*sarama.Config, error) {
+	config, err := c.ClientConfig.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.SessionTimeout > 0 {
+		config.Consumer.Group.Session.Timeout = c.SessionTimeout
+	}
+	if c.HeartbeatInterval > 0 {
+		config.Consumer.Group.Heartbeat.Interval = c.HeartbeatInterval
+	}
+	if c.RebalanceTimeout > 0 {
+		config.Consumer.Group.Rebalance.Timeout = c.RebalanceTimeout
+	}
+	if c.FetchMinBytes > 0 {
+		config.Consumer.Fetch.Min = c.FetchMinBytes
+	}
+	if c.FetchMaxBytes > 0 {
+		config.Consumer.Fetch.Max = c.FetchMaxBytes
+	}
+	if c.MaxProcessingTime > 0 {
+		config.Consumer.MaxProcessingTime = c.MaxProcessingTime
+	}
+	if c.ChannelBufferSize > 0 {
+		config.ChannelBufferSize = c.ChannelBufferSize
+	}
+	if c.IsolationLevel == ReadCommitted {
+		config.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+	return config, nil
 }
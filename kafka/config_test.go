@@ -0,0 +1,104 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+func TestConsumerConfig_Validate(t *testing.T) {
+	cfg := ConsumerConfig{
+		ClientConfig:    ClientConfig{Version: "x.y", Metrics: metrics.NewRegistry()},
+		BalanceStrategy: "fair",
+		Offset:          "latest",
+		CommitMode:      "eventually",
+		Retry:           &RetryPolicy{},
+	}
+	err := cfg.validate()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	for _, field := range []string{
+		"Brokers", "Version", "Group", "Topics", "BalanceStrategy", "Offset", "Decoder",
+		"Handler", "Retry.Producer", "Retry.Delays", "CommitMode",
+	} {
+		if !errs.Has(field) {
+			t.Errorf("Expected an error of %s, got %s", field, errs)
+		}
+	}
+}
+
+func TestConsumerConfig_ValidateDefaults(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	if cfg.Offset != Newest || cfg.CommitMode != CommitAuto || cfg.Handler == nil || cfg.Logger == nil {
+		t.Errorf("Expected the default values to be set, got %+v", cfg)
+	}
+}
+
+func TestNewConsumerGroup_InvalidConfig(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Topics = nil
+	if _, err := NewConsumerGroup(cfg); !errors.As(err, new(ValidationErrors)) {
+		t.Errorf("Expected validation errors, got %v", err)
+	}
+}
+
+func TestNewProducer_InvalidConfig(t *testing.T) {
+	_, err := NewProducer(ProducerConfig{
+		ClientConfig: ClientConfig{Version: "x.y", Metrics: metrics.NewRegistry()},
+		Acks:         AcksLeader,
+		Idempotent:   true,
+		Compression:  "brotli",
+	})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	for _, field := range []string{"Brokers", "Version", "Acks", "Compression"} {
+		if !errs.Has(field) {
+			t.Errorf("Expected an error of %s, got %s", field, errs)
+		}
+	}
+}
+
+func TestProducerConfig_SaramaConfig(t *testing.T) {
+	cfg := ProducerConfig{
+		ClientConfig: ClientConfig{Brokers: []string{"localhost:9092"}, Metrics: metrics.NewRegistry()},
+		Compression:  CompressionGzip,
+		Idempotent:   true,
+		Partitioner:  RoundRobinPartitioner,
+		RetryBackoff: 100 * time.Millisecond,
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err = config.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, found error %s", err)
+	}
+	if config.Version != sarama.V2_0_1_0 || config.Producer.RequiredAcks != sarama.WaitForAll ||
+		config.Producer.Compression != sarama.CompressionGZIP || !config.Producer.Idempotent ||
+		config.Producer.Retry.Max != 10 || config.Producer.Retry.Backoff != 100*time.Millisecond ||
+		config.Producer.MaxMessageBytes != 10000000 {
+		t.Errorf("Unexpected producer configurations %+v", config.Producer)
+	}
+	partitioner := config.Producer.Partitioner("orders")
+	first, _ := partitioner.Partition(&sarama.ProducerMessage{}, 3)
+	second, _ := partitioner.Partition(&sarama.ProducerMessage{}, 3)
+	if second != (first+1)%3 {
+		t.Errorf("Expected the round robin partitioner, got partitions %d and %d", first, second)
+	}
+}
@@ -8,44 +8,101 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"os/signal"
+	"strings"
 	"sync"
-	"syscall"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
 
+// errorsBufferSize capacity of the channel returned by ConsumerGroup.Errors.
+const errorsBufferSize = 64
+
 // ConsumerGroup the interface for manage consumer group
 type ConsumerGroup interface {
 	// Init initialize the consumer group.
 	Init() (err error)
-	// Run start the consumer group.
-	Run() (err error)
+	// Run starts the consumer group and blocks until ctx is cancelled, Stop is
+	// called or consuming fails. Signal handling is left to the application.
+	Run(ctx context.Context) (err error)
+	// Stop stops the consumer group and waits until Run returns.
+	Stop()
+	// Errors returns the errors of the consumer group. Errors are only
+	// reported when ConsumerConfig.ReturnErrors is enabled.
+	Errors() <-chan error
+	// Ready returns an error until the consumer group has joined the group
+	// and finished the setup of the session.
+	Ready(ctx context.Context) error
+	// Pause pauses the consumption of the given topics. All the subscribed
+	// topics are paused if no topic is given.
+	Pause(topics ...string)
+	// Resume resumes the consumption of the given topics. Everything paused is
+	// resumed if no topic is given.
+	Resume(topics ...string)
+	// PausePartitions pauses the consumption of the given partitions.
+	PausePartitions(partitions map[string][]int32)
+	// ResumePartitions resumes the consumption of the given partitions.
+	ResumePartitions(partitions map[string][]int32)
+	// State returns the consumption state of the consumer group.
+	State() ConsumerState
 }
 
-func NewConsumerGroup(config Config) ConsumerGroup {
+// NewConsumerGroup creates a consumer group. It returns ValidationErrors if
+// the configurations are invalid.
+func NewConsumerGroup(config ConsumerConfig) (ConsumerGroup, error) {
 	// Validate configuration before create the consumer group instance.
-	config.validate()
-	return &consumerGroup{
-		cfg: config,
+	if err := config.validate(); err != nil {
+		return nil, err
 	}
+	return &consumerGroup{
+		cfg:              config,
+		errors:           make(chan error, errorsBufferSize),
+		newClient:        sarama.NewConsumerGroup,
+		missingTopics:    missingTopics,
+		assigned:         make(partitionSet),
+		paused:           make(partitionSet),
+		pausedTopics:     make(map[string]bool),
+		pausedPartitions: make(partitionSet),
+		delayed:          make(partitionSet),
+	}, nil
 }
 
 type consumerGroup struct {
-	cfg       Config
+	cfg       ConsumerConfig
 	saramaCfg *sarama.Config
+	client    sarama.ConsumerGroup
+	newClient func(addrs []string, groupID string, config *sarama.Config) (sarama.ConsumerGroup, error)
+	// missingTopics returns the topics which do not exist, the retry topics are
+	// checked before joining the group.
+	missingTopics func(cfg ClientConfig, topics []string) ([]string, error)
+	// lagMonitor monitor of the lag while running, if configured.
+	lagMonitor *LagMonitor
+	handler    *ConsumerGroupHandler
+	errors     chan error
+	cancel     context.CancelFunc
+	done       chan struct{}
+	mu         sync.RWMutex
+
+	// memberID, generationID and assigned partitions of the current session.
+	memberID     string
+	generationID int32
+	assigned     partitionSet
+	// paused assigned partitions which are paused in sarama.
+	paused partitionSet
+	// pausedTopics and pausedPartitions requested pauses.
+	pausedTopics     map[string]bool
+	pausedPartitions partitionSet
+	// delayed partitions paused until a retried message is due.
+	delayed partitionSet
 }
 
 // Init initialize the consumer group.
-func (c *consumerGroup) Init() (err error) {
-	config := sarama.NewConfig()
-	var version sarama.KafkaVersion
-
-	if version, err = sarama.ParseKafkaVersion(string(c.cfg.Version)); err != nil {
-		return
+func (c *consumerGroup) Init() error {
+	config, err := c.cfg.saramaConfig()
+	if err != nil {
+		return err
 	}
 	switch c.cfg.BalanceStrategy {
 	case Sticky:
@@ -55,11 +112,9 @@ func (c *consumerGroup) Init() (err error) {
 	case Range:
 		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
 	default:
-		err = fmt.Errorf("invalid strategy: %s", c.cfg.BalanceStrategy)
+		return fmt.Errorf("invalid strategy: %s", c.cfg.BalanceStrategy)
 	}
 
-	config.Version = version
-
 	switch c.cfg.Offset {
 	case Oldest:
 		config.Consumer.Offsets.Initial = sarama.OffsetOldest
@@ -68,74 +123,178 @@ func (c *consumerGroup) Init() (err error) {
 	default:
 		config.Consumer.Offsets.Initial = sarama.OffsetNewest
 	}
+	config.Consumer.Return.Errors = c.cfg.ReturnErrors
+	// The offsets of the transactional consumer are committed by the transactions.
+	config.Consumer.Offsets.AutoCommit.Enable = c.cfg.CommitMode == CommitAuto && c.cfg.Transactional == nil
 	sarama.Logger = c.getSaramaLogger()
 	c.saramaCfg = config
-	return
+	return nil
 }
 
-// Run start the consumer group.
-func (c *consumerGroup) Run() (err error) {
-	keepRunning := true
-
-	ctx, cancel := context.WithCancel(context.Background())
-	client, err := sarama.NewConsumerGroup(c.cfg.Brokers, c.cfg.Group, c.saramaCfg)
+// Run starts the consumer group and blocks until ctx is cancelled, Stop is
+// called or consuming fails.
+func (c *consumerGroup) Run(ctx context.Context) (err error) {
+	if c.saramaCfg == nil {
+		return errors.New("consumer group is not initialized")
+	}
+	if c.cfg.Retry != nil {
+		// A missing subscribed topic would fail every join of the group.
+		missing, err := c.missingTopics(c.cfg.ClientConfig, c.cfg.Retry.topics(c.cfg.Topics))
+		if err != nil {
+			return fmt.Errorf("unable to check the retry topics: %w", err)
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("retry topics do not exist: %s", strings.Join(missing, ", "))
+		}
+	}
+	client, err := c.newClient(c.cfg.Brokers, c.cfg.Group, c.saramaCfg)
 	if err != nil {
-		cancel()
 		return fmt.Errorf("error creating consumer group client: %s", err)
 	}
 
-	consumptionIsPaused := false
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+
 	cgh := getConsumerGroupHandler(c.cfg)
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err = client.Consume(ctx, c.cfg.Topics, cgh); err != nil {
-			err = fmt.Errorf("error from consumer: %s", err)
-			return
+	cgh.listener = c
+	c.mu.Lock()
+	c.client = client
+	c.handler = cgh
+	c.cancel = cancel
+	c.done = done
+	c.mu.Unlock()
+
+	if c.saramaCfg.Consumer.Return.Errors {
+		go c.forwardErrors(client.Errors())
+	}
+	if c.cfg.Lag != nil {
+		stopMonitor, err := c.startLagMonitor(ctx)
+		if err != nil {
+			_ = client.Close()
+			return err
 		}
+		defer stopMonitor()
+	}
+
+	err = c.consume(ctx, client, cgh)
+	cancel()
+	if closeErr := client.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// consume joins the consumer group again after every rebalance or session
+// expiry until ctx is cancelled. Errors, including the failed claims which
+// ended the session, are retried with exponential backoff.
+func (c *consumerGroup) consume(ctx context.Context, client sarama.ConsumerGroup, cgh *ConsumerGroupHandler) error {
+	backoff := c.cfg.RejoinBackoff
+	for {
+		err := client.Consume(ctx, c.topics(), cgh)
+		failed := cgh.reset()
 		if ctx.Err() != nil {
-			return
+			return nil
+		}
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return fmt.Errorf("error from consumer: %s", err)
+		}
+		if err == nil && failed {
+			// sarama ends the session without an error, e.g. after an aborted transaction.
+			err = errors.New("a claim of the session failed")
 		}
-		cgh.ready = make(chan bool)
+		if err == nil {
+			backoff = c.cfg.RejoinBackoff
+			c.cfg.Logger.Debugf("Rejoining consumer group %s after rebalance", c.cfg.Group)
+			continue
+		}
+		c.cfg.Logger.WithError(err).Errorf("Error from consumer, rejoining consumer group %s in %v", c.cfg.Group, backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.cfg.MaxRejoinBackoff {
+			backoff = c.cfg.MaxRejoinBackoff
+		}
+	}
+}
 
+// topics returns the subscribed topics, including the retry topics.
+func (c *consumerGroup) topics() []string {
+	if c.cfg.Retry == nil {
+		return c.cfg.Topics
+	}
+	topics := append([]string(nil), c.cfg.Topics...)
+	return append(topics, c.cfg.Retry.topics(c.cfg.Topics)...)
+}
+
+// startLagMonitor starts monitoring the lag until ctx is cancelled. The
+// returned function waits until the monitor stops.
+func (c *consumerGroup) startLagMonitor(ctx context.Context) (stop func(), err error) {
+	admin, err := NewOffsetAdmin(c.cfg.ClientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the lag monitor: %s", err)
+	}
+	policy := *c.cfg.Lag
+	policy.Offset = c.cfg.Offset
+	monitor := NewLagMonitor(admin, c.cfg.Group, c.cfg.Topics, policy, c.cfg.Metrics)
+	c.mu.Lock()
+	c.lagMonitor = monitor
+	c.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		monitor.Run(ctx, func(err error) {
+			c.cfg.Logger.WithError(err).Errorf("Lag check failed")
+		})
 	}()
+	return func() {
+		<-done
+		_ = admin.Close()
+	}, nil
+}
 
-	<-cgh.ready
-	sigusr1 := make(chan os.Signal, 1)
-	signal.Notify(sigusr1, syscall.SIGUSR1)
+// Stop stops the consumer group and waits until Run returns.
+func (c *consumerGroup) Stop() {
+	c.mu.RLock()
+	cancel, done := c.cancel, c.done
+	c.mu.RUnlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
 
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
+// Errors returns the errors of the consumer group.
+func (c *consumerGroup) Errors() <-chan error {
+	return c.errors
+}
 
-	for keepRunning {
+// forwardErrors forwards the errors of the sarama consumer group. sarama
+// blocks when its errors are not drained, so errors are dropped when the
+// channel is full.
+func (c *consumerGroup) forwardErrors(errs <-chan error) {
+	for err := range errs {
 		select {
-		case <-ctx.Done():
-			log.Println("terminating: context cancelled")
-			keepRunning = false
-		case <-sigterm:
-			log.Println("terminating: via signal")
-			keepRunning = false
-		case <-sigusr1:
-			c.toggleConsumptionFlow(client, &consumptionIsPaused)
+		case c.errors <- err:
+		default:
+			c.cfg.Logger.WithError(err).Errorf("Consumer group error dropped")
 		}
 	}
-
-	cancel()
-	wg.Wait()
-	if err = client.Close(); err != nil {
-		return err
-	}
-	return nil
 }
 
-func (c *consumerGroup) toggleConsumptionFlow(client sarama.ConsumerGroup, isPaused *bool) {
-	if *isPaused {
-		client.ResumeAll()
-	} else {
-		client.PauseAll()
+// Ready returns an error until the consumer group has joined the group and
+// finished the setup of the session.
+func (c *consumerGroup) Ready(context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.handler == nil || !c.handler.isReady() {
+		return fmt.Errorf("consumer group %s is not ready", c.cfg.Group)
 	}
-	*isPaused = !*isPaused
+	return nil
 }
 
 func (c *consumerGroup) getSaramaLogger() sarama.StdLogger {
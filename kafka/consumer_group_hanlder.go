@@ -7,50 +7,195 @@
 package kafka
 
 import (
+	"sync"
+
 	"github.com/Shopify/sarama"
 )
 
 // ConsumerGroupHandler implementation for ConsumerGroupHandler.
 type ConsumerGroupHandler struct {
-	cfg   Config
-	ready chan bool
+	cfg ConsumerConfig
+	// handler ConsumerConfig.Handler wrapped with the middlewares.
+	handler   Handler
+	ready     chan bool
+	metrics   *consumerMetrics
+	committer *committer
+	listener  sessionListener
+	// newTransaction creates the transactional producer of a claim when
+	// ConsumerConfig.Transactional is set.
+	newTransaction func(cfg ProducerConfig) (*transaction, error)
+	// failed whether a claim of the current session failed.
+	failed bool
+	mu     sync.RWMutex
 }
 
-func getConsumerGroupHandler(cfg Config) *ConsumerGroupHandler {
-	return &ConsumerGroupHandler{
-		ready: make(chan bool),
-		cfg:   cfg,
+func getConsumerGroupHandler(cfg ConsumerConfig) *ConsumerGroupHandler {
+	c := &ConsumerGroupHandler{
+		ready:     make(chan bool),
+		cfg:       cfg,
+		metrics:   newConsumerMetrics(cfg.Metrics),
+		committer: newCommitter(cfg),
+	}
+	middlewares := cfg.Middlewares
+	if cfg.Dedup != nil {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], c.dedup(cfg.Dedup))
+	}
+	c.handler = chain(cfg.Handler, middlewares)
+	if cfg.Transactional != nil {
+		c.newTransaction = newTransaction
 	}
+	return c
 }
 
 // Setup setup the consumer group session.
-func (c *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+func (c *ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	c.cfg.Logger.Infof("Joined consumer group %s: member = %s, generation = %d, claims = %v",
+		c.cfg.Group, session.MemberID(), session.GenerationID(), session.Claims())
+	c.metrics.generation.Set(float64(session.GenerationID()), c.cfg.Group)
+	c.metrics.rebalances.Inc(c.cfg.Group)
+	if c.listener != nil {
+		c.listener.sessionStarted(session)
+	}
+	if c.cfg.RebalanceListener != nil {
+		c.cfg.RebalanceListener.OnPartitionsAssigned(session.GenerationID(), session.Claims())
+	}
+	if c.cfg.CommitMode != CommitAuto {
+		go c.committer.run(session)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	close(c.ready)
 	return nil
 }
 
-// Cleanup cleanup the consumer group session.
-func (c *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+// readyChan returns the channel closed when the setup of the session is finished.
+func (c *ConsumerGroupHandler) readyChan() <-chan bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ready
+}
+
+// isReady reports whether the setup of the current session is finished.
+func (c *ConsumerGroupHandler) isReady() bool {
+	select {
+	case <-c.readyChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// reset prepares the handler for the next session and reports whether a
+// claim of the previous one failed.
+func (c *ConsumerGroupHandler) reset() (failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ready = make(chan bool)
+	failed, c.failed = c.failed, false
+	return failed
+}
+
+// fail records that a claim of the current session failed.
+func (c *ConsumerGroupHandler) fail() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed = true
+}
+
+// Cleanup cleanup the consumer group session. It is called after all the
+// claims of the session are processed, before the partitions are revoked.
+func (c *ConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	if c.cfg.RebalanceListener != nil {
+		c.cfg.RebalanceListener.OnPartitionsRevoked(session.GenerationID(), session.Claims())
+	}
+	// Offsets are not committed when the session is closed unless sarama
+	// commits automatically.
+	c.committer.commit(session)
+	if c.listener != nil {
+		c.listener.sessionEnded(session)
+	}
 	return nil
 }
 
-// ConsumeClaim decode messages and call the consumer callback function configured.
-func (c *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		c.cfg.Logger.Debugf("Message claimed: value = %s, timestamp = %v, topic = %s", string(message.Value), message.Timestamp, message.Topic)
-		key, value, err := c.cfg.Decoder(message)
+// ConsumeClaim decode messages and call the handler configured. An error
+// ends the session, which is joined again with the rejoin backoff.
+func (c *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) (err error) {
+	defer func() {
 		if err != nil {
-			c.cfg.Logger.Errorf("Unable to encode the message. value = %s, timestamp = %v, topic = %s", string(message.Value), message.Timestamp, message.Topic)
+			c.fail()
 		}
-		err = c.cfg.ConsumerCallback(key, value)
-		if err != nil {
-			// If any errors while consuming the message.
-			if c.cfg.ConsumerErrorHandler(err) {
-				session.MarkMessage(message, "")
-			}
-			continue
+	}()
+	if c.listener != nil {
+		c.listener.claimStarted(claim.Topic(), claim.Partition())
+	}
+	if c.cfg.Transactional != nil {
+		return c.consumeTransactionally(session, claim)
+	}
+	if c.cfg.BatchCallback != nil {
+		return c.consumeBatches(session, claim)
+	}
+	if c.cfg.Concurrency > 1 {
+		return c.consumeConcurrently(session, claim)
+	}
+	mark := c.marker(session)
+	for message := range claim.Messages() {
+		if !c.waitUntilDue(session.Context(), message) {
+			return nil
+		}
+		if c.process(session, message, mark) {
+			mark(message)
 		}
-		session.MarkMessage(message, "")
 	}
 	return nil
 }
+
+// marker returns the function marking the messages of the session.
+func (c *ConsumerGroupHandler) marker(session sarama.ConsumerGroupSession) func(message *sarama.ConsumerMessage) {
+	return func(message *sarama.ConsumerMessage) {
+		c.committer.mark(session, message)
+	}
+}
+
+// process decodes the message and calls the handler. It reports whether the
+// offset of the message should be marked; in the CommitManual mode handled
+// messages are marked with mark by Message.Ack.
+func (c *ConsumerGroupHandler) process(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, mark func(*sarama.ConsumerMessage)) (commit bool) {
+	ctx := session.Context()
+	msg, err := c.decode(message, mark)
+	if err != nil {
+		return c.handleFailure(ctx, msg, err)
+	}
+	if err = c.handler(ctx, msg); err != nil {
+		c.metrics.callbackErrors.Inc(message.Topic, partitionLabel(message.Partition))
+		// If any errors while consuming the message.
+		return c.handleFailure(ctx, msg, err)
+	}
+	return c.cfg.CommitMode != CommitManual
+}
+
+// decode decodes the key and the value of the consumed message. Message.Ack
+// marks the message with mark in the CommitManual mode.
+func (c *ConsumerGroupHandler) decode(message *sarama.ConsumerMessage, mark func(*sarama.ConsumerMessage)) (msg *Message, err error) {
+	partition := partitionLabel(message.Partition)
+	c.cfg.Logger.Debugf("Message claimed: value = %s, timestamp = %v, topic = %s", string(message.Value), message.Timestamp, message.Topic)
+	c.metrics.consumed.Inc(message.Topic, partition)
+	msg = newMessage(message)
+	if c.cfg.Retry != nil {
+		if source, ok := c.cfg.Retry.source(msg); ok {
+			msg.Topic = source
+		}
+	}
+	if c.cfg.CommitMode == CommitManual {
+		msg.ack = func() { mark(message) }
+	}
+	if c.cfg.decodeMessage != nil {
+		msg.Key, msg.Value, err = c.cfg.decodeMessage(msg)
+	} else {
+		msg.Key, msg.Value, err = c.cfg.Decoder(message)
+	}
+	if err != nil {
+		c.metrics.decodeFailures.Inc(message.Topic, partition)
+		c.cfg.Logger.WithError(err).Errorf("Unable to decode the message. value = %s, timestamp = %v, topic = %s", string(message.Value), message.Timestamp, message.Topic)
+	}
+	return msg, err
+}
@@ -0,0 +1,246 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+type mockSession struct {
+	ctx        context.Context
+	claims     map[string][]int32
+	generation int32
+	marked     []int64
+	// committed marked offsets at each Commit call.
+	committed [][]int64
+	mu        sync.Mutex
+}
+
+func newMockSession() *mockSession {
+	return &mockSession{ctx: context.Background(), claims: map[string][]int32{}, generation: 1}
+}
+
+func (m *mockSession) Claims() map[string][]int32 { return m.claims }
+func (m *mockSession) MemberID() string           { return "member" }
+func (m *mockSession) GenerationID() int32        { return m.generation }
+func (m *mockSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.marked = append(m.marked, offset)
+}
+func (m *mockSession) Commit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.committed = append(m.committed, append([]int64(nil), m.marked...))
+}
+func (m *mockSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (m *mockSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	m.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+func (m *mockSession) Context() context.Context { return m.ctx }
+
+func (m *mockSession) markedOffsets() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int64(nil), m.marked...)
+}
+
+type mockClaim struct {
+	topic     string
+	partition int32
+	messages  chan *sarama.ConsumerMessage
+}
+
+// newMockClaim creates a claim which delivers the given values and closes.
+func newMockClaim(topic string, partition int32, values ...string) *mockClaim {
+	messages := make(chan *sarama.ConsumerMessage, len(values))
+	for i, v := range values {
+		messages <- &sarama.ConsumerMessage{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    int64(i),
+			Key:       []byte(v),
+			Value:     []byte(v),
+		}
+	}
+	close(messages)
+	return &mockClaim{topic: topic, partition: partition, messages: messages}
+}
+
+func (m *mockClaim) Topic() string                            { return m.topic }
+func (m *mockClaim) Partition() int32                         { return m.partition }
+func (m *mockClaim) InitialOffset() int64                     { return 0 }
+func (m *mockClaim) HighWaterMarkOffset() int64               { return int64(cap(m.messages)) }
+func (m *mockClaim) Messages() <-chan *sarama.ConsumerMessage { return m.messages }
+
+func newTestConfig(callback ConsumerCallback) ConsumerConfig {
+	cfg := ConsumerConfig{
+		ClientConfig: ClientConfig{
+			Brokers: []string{"localhost:9092"},
+			Version: Version_2_1_1,
+			Metrics: metrics.NewRegistry(),
+		},
+		Group:            "group",
+		Topics:           []string{"orders"},
+		BalanceStrategy:  Range,
+		Decoder:          GetDefaultDecoder(),
+		ConsumerCallback: callback,
+	}
+	if err := cfg.validate(); err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func TestConsumerGroupHandler_Metrics(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error {
+		if value == "bad" {
+			return errors.New("unable to process")
+		}
+		return nil
+	})
+	cfg.ConsumerErrorHandler = func(err error) bool { return false }
+	session := newMockSession()
+	handler := getConsumerGroupHandler(cfg)
+	if err := handler.ConsumeClaim(session, newMockClaim("orders", 0, "a", "bad", "c")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	_ = cfg.Metrics.WriteText(buf)
+	for _, line := range []string{
+		`sterna_kafka_consumer_messages_total{topic="orders",partition="0"} 3`,
+		`sterna_kafka_consumer_callback_errors_total{topic="orders",partition="0"} 1`,
+		`sterna_kafka_consumer_error_decisions_total{topic="orders",partition="0",decision="skip"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected metrics to contain %s, got\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestConsumerGroupHandler_Handler(t *testing.T) {
+	var received []*Message
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		received = append(received, msg)
+		return nil
+	}
+	claim := &mockClaim{topic: "orders", partition: 3, messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    7,
+		Value:     []byte("a"),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("event-type"), Value: []byte("created")}},
+	}
+	close(claim.messages)
+
+	session := newMockSession()
+	if err := getConsumerGroupHandler(cfg).ConsumeClaim(session, claim); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(received))
+	}
+	msg := received[0]
+	if msg.Topic != "orders" || msg.Partition != 3 || msg.Offset != 7 || msg.Value != "a" || string(msg.RawValue) != "a" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	if v, ok := msg.Header("event-type"); !ok || string(v) != "created" {
+		t.Errorf("Expected header event-type=created, got %s", v)
+	}
+}
+
+type mockProducer struct {
+	failures int
+	messages []*sarama.ProducerMessage
+	mu       sync.Mutex
+}
+
+func (m *mockProducer) Produce(topic string, schema string, key interface{}, value interface{}) (int32, int64, error) {
+	return 0, 0, errors.New("not supported")
+}
+
+func (m *mockProducer) ProduceRaw(msg *sarama.ProducerMessage) (int32, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return 0, 0, errors.New("broker not available")
+	}
+	m.messages = append(m.messages, msg)
+	return 0, int64(len(m.messages)), nil
+}
+
+func (m *mockProducer) ProduceMessage(ctx context.Context, msg *Message) (int32, int64, error) {
+	return 0, 0, errors.New("not supported")
+}
+
+func (m *mockProducer) ProduceBatch(ctx context.Context, msgs []*Message) error {
+	return errors.New("not supported")
+}
+
+func (m *mockProducer) Ready(ctx context.Context) error { return nil }
+func (m *mockProducer) Close() error                    { return nil }
+
+func TestConsumerGroupHandler_DeadLetter(t *testing.T) {
+	producer := &mockProducer{failures: 1}
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		if msg.Value == "bad" {
+			return errors.New("unable to process")
+		}
+		return nil
+	}
+	cfg.DeadLetter = &DeadLetterPolicy{Producer: producer}
+	cfg.RepublishBackoff = time.Millisecond
+	session := newMockSession()
+	if err := getConsumerGroupHandler(cfg).ConsumeClaim(session, newMockClaim("orders", 2, "a", "bad")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 2}) {
+		t.Errorf("Expected offsets [1 2] to be committed, got %v", session.markedOffsets())
+	}
+	if len(producer.messages) != 1 {
+		t.Fatalf("Expected 1 dead-lettered message, got %d", len(producer.messages))
+	}
+	msg := producer.messages[0]
+	if msg.Topic != "orders.dlq" {
+		t.Errorf("Expected topic orders.dlq, got %s", msg.Topic)
+	}
+	if value, _ := msg.Value.Encode(); string(value) != "bad" {
+		t.Errorf("Expected the original value, got %s", value)
+	}
+	headers := map[string]string{}
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	for key, value := range map[string]string{
+		HeaderError:           "unable to process",
+		HeaderSourceTopic:     "orders",
+		HeaderSourcePartition: "2",
+		HeaderSourceOffset:    "1",
+		HeaderAttempt:         "1",
+	} {
+		if headers[key] != value {
+			t.Errorf("Expected header %s=%s, got %s", key, value, headers[key])
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// mockClient records the pause and resume calls of the consumer group.
+type mockClient struct {
+	// consumeErrs errors returned by the first calls of Consume.
+	consumeErrs []error
+	// sessions number of sessions started and ended (rebalanced) before
+	// Consume blocks until the context is cancelled.
+	sessions int
+	calls    int
+	paused   []map[string][]int32
+	resumed  []map[string][]int32
+	mu       sync.Mutex
+}
+
+func (m *mockClient) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	m.mu.Lock()
+	m.calls++
+	calls := m.calls
+	m.mu.Unlock()
+	if calls <= len(m.consumeErrs) {
+		return m.consumeErrs[calls-1]
+	}
+	session := newMockSession()
+	session.generation = int32(calls)
+	session.claims = map[string][]int32{topics[0]: {0}}
+	if err := handler.Setup(session); err != nil {
+		return err
+	}
+	if calls <= len(m.consumeErrs)+m.sessions {
+		return handler.Cleanup(session)
+	}
+	<-ctx.Done()
+	return handler.Cleanup(session)
+}
+func (m *mockClient) Errors() <-chan error { return nil }
+func (m *mockClient) Close() error         { return nil }
+func (m *mockClient) Pause(partitions map[string][]int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = append(m.paused, partitions)
+}
+func (m *mockClient) Resume(partitions map[string][]int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resumed = append(m.resumed, partitions)
+}
+func (m *mockClient) PauseAll()  {}
+func (m *mockClient) ResumeAll() {}
+
+func newTestConsumerGroup(client sarama.ConsumerGroup) *consumerGroup {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Topics = []string{"orders", "payments"}
+	group, err := NewConsumerGroup(cfg)
+	if err != nil {
+		panic(err)
+	}
+	cg := group.(*consumerGroup)
+	cg.client = client
+	cg.newClient = func([]string, string, *sarama.Config) (sarama.ConsumerGroup, error) {
+		return client, nil
+	}
+	cg.missingTopics = func(ClientConfig, []string) ([]string, error) { return nil, nil }
+	return cg
+}
+
+func TestConsumerGroup_RunStop(t *testing.T) {
+	cg := newTestConsumerGroup(&mockClient{})
+	if err := cg.Init(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cg.Run(context.Background()) }()
+	for {
+		cg.mu.RLock()
+		running := cg.cancel != nil
+		cg.mu.RUnlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cg.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Run to return without error, got %s", err)
+	}
+}
+
+func TestConsumerGroup_RunError(t *testing.T) {
+	cg := newTestConsumerGroup(&mockClient{consumeErrs: []error{sarama.ErrClosedConsumerGroup}})
+	if err := cg.Init(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err := cg.Run(context.Background()); err == nil {
+		t.Errorf("Expected the consume error to be returned")
+	}
+}
+
+type recordingListener struct {
+	events []string
+	mu     sync.Mutex
+}
+
+func (r *recordingListener) OnPartitionsAssigned(generationID int32, partitions map[string][]int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf("assigned %d %v", generationID, partitions))
+}
+
+func (r *recordingListener) OnPartitionsRevoked(generationID int32, partitions map[string][]int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf("revoked %d %v", generationID, partitions))
+}
+
+func TestConsumerGroup_RejoinAfterRebalance(t *testing.T) {
+	listener := &recordingListener{}
+	client := &mockClient{consumeErrs: []error{errors.New("coordinator not available")}, sessions: 2}
+	cg := newTestConsumerGroup(client)
+	cg.cfg.RebalanceListener = listener
+	cg.cfg.RejoinBackoff = time.Millisecond
+	if err := cg.Init(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cg.Run(context.Background()) }()
+
+	deadline := time.Now().Add(time.Second)
+	for cg.Ready(context.Background()) != nil || cg.State().GenerationID != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Consumer group did not rejoin, state %+v", cg.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cg.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Run to return without error, got %s", err)
+	}
+	expected := []string{
+		"assigned 2 map[orders:[0]]", "revoked 2 map[orders:[0]]",
+		"assigned 3 map[orders:[0]]", "revoked 3 map[orders:[0]]",
+		"assigned 4 map[orders:[0]]", "revoked 4 map[orders:[0]]",
+	}
+	if !reflect.DeepEqual(listener.events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, listener.events)
+	}
+}
+
+func TestConsumerGroup_PauseResume(t *testing.T) {
+	client := &mockClient{}
+	cg := newTestConsumerGroup(client)
+
+	// Pause requested before the partitions are claimed.
+	cg.Pause("payments")
+	session := newMockSession()
+	session.claims = map[string][]int32{"orders": {0, 1}, "payments": {0}}
+	cg.sessionStarted(session)
+	cg.claimStarted("orders", 0)
+	cg.claimStarted("orders", 1)
+	cg.claimStarted("payments", 0)
+	cg.PausePartitions(map[string][]int32{"orders": {1}})
+
+	state := cg.State()
+	expected := map[string][]int32{"orders": {1}, "payments": {0}}
+	if !reflect.DeepEqual(state.Paused, expected) {
+		t.Errorf("Expected paused partitions %v, got %v", expected, state.Paused)
+	}
+	if !reflect.DeepEqual(state.PausedTopics, []string{"payments"}) {
+		t.Errorf("Expected paused topics [payments], got %v", state.PausedTopics)
+	}
+
+	cg.Resume("payments")
+	expectedResumed := []map[string][]int32{{"payments": {0}}}
+	if !reflect.DeepEqual(client.resumed, expectedResumed) {
+		t.Errorf("Expected resumed partitions %v, got %v", expectedResumed, client.resumed)
+	}
+	expectedPaused := []map[string][]int32{{"payments": {0}}, {"orders": {1}}}
+	if !reflect.DeepEqual(client.paused, expectedPaused) {
+		t.Errorf("Expected paused partitions %v, got %v", expectedPaused, client.paused)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	cg := newTestConsumerGroup(&mockClient{})
+	session := newMockSession()
+	session.claims = map[string][]int32{"orders": {0}, "payments": {0}}
+	cg.sessionStarted(session)
+	handler := NewAdminHandler(cg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pause", strings.NewReader(`{"topics": ["orders"]}`)))
+	state := ConsumerState{}
+	if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+		t.Fatalf("Unable to decode the response %s", err)
+	}
+	if !reflect.DeepEqual(state.Paused, map[string][]int32{"orders": {0}}) {
+		t.Errorf("Expected orders to be paused, got %v", state.Paused)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/resume", nil))
+	if state := cg.State(); len(state.Paused) != 0 || len(state.PausedTopics) != 0 {
+		t.Errorf("Expected everything to be resumed, got %+v", state)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pause", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// ConsumerState consumption state of the consumer group.
+type ConsumerState struct {
+	// Group consumer group id.
+	Group string `json:"group"`
+	// MemberID member id of this consumer in the current session.
+	MemberID string `json:"member_id"`
+	// GenerationID generation id of the current session.
+	GenerationID int32 `json:"generation_id"`
+	// Assigned partitions assigned to this member in the current session.
+	Assigned map[string][]int32 `json:"assigned"`
+	// Paused assigned partitions which are currently paused.
+	Paused map[string][]int32 `json:"paused"`
+	// PausedTopics topics paused as a whole, including partitions assigned later.
+	PausedTopics []string `json:"paused_topics"`
+	// PausedPartitions partitions paused individually.
+	PausedPartitions map[string][]int32 `json:"paused_partitions"`
+	// Lag lag of the last check of the lag monitor, if configured.
+	Lag []PartitionLag `json:"lag,omitempty"`
+}
+
+// sessionListener receives the assignment changes of the consumer group sessions.
+type sessionListener interface {
+	sessionStarted(session sarama.ConsumerGroupSession)
+	claimStarted(topic string, partition int32)
+	delayStarted(topic string, partition int32)
+	delayEnded(topic string, partition int32)
+	sessionEnded(session sarama.ConsumerGroupSession)
+}
+
+// partitionSet set of partitions per topic.
+type partitionSet map[string]map[int32]bool
+
+func (ps partitionSet) add(topic string, partition int32) {
+	if ps[topic] == nil {
+		ps[topic] = make(map[int32]bool)
+	}
+	ps[topic][partition] = true
+}
+
+func (ps partitionSet) remove(topic string, partition int32) {
+	delete(ps[topic], partition)
+	if len(ps[topic]) == 0 {
+		delete(ps, topic)
+	}
+}
+
+func (ps partitionSet) contains(topic string, partition int32) bool {
+	return ps[topic][partition]
+}
+
+// toMap converts the set to the sorted map used by sarama.
+func (ps partitionSet) toMap() map[string][]int32 {
+	m := make(map[string][]int32, len(ps))
+	for topic, partitions := range ps {
+		for p := range partitions {
+			m[topic] = append(m[topic], p)
+		}
+		sort.Slice(m[topic], func(i, j int) bool { return m[topic][i] < m[topic][j] })
+	}
+	return m
+}
+
+func newPartitionSet(m map[string][]int32) partitionSet {
+	ps := make(partitionSet, len(m))
+	for topic, partitions := range m {
+		for _, p := range partitions {
+			ps.add(topic, p)
+		}
+	}
+	return ps
+}
+
+// Pause pauses the consumption of the given topics. All the subscribed topics
+// are paused if no topic is given.
+func (c *consumerGroup) Pause(topics ...string) {
+	if len(topics) == 0 {
+		topics = c.topics()
+	}
+	c.mu.Lock()
+	for _, topic := range topics {
+		c.pausedTopics[topic] = true
+	}
+	c.mu.Unlock()
+	c.applyPauses()
+}
+
+// Resume resumes the consumption of the given topics. Everything paused,
+// including individual partitions, is resumed if no topic is given.
+func (c *consumerGroup) Resume(topics ...string) {
+	c.mu.Lock()
+	if len(topics) == 0 {
+		c.pausedTopics = make(map[string]bool)
+		c.pausedPartitions = make(partitionSet)
+	}
+	for _, topic := range topics {
+		delete(c.pausedTopics, topic)
+		delete(c.pausedPartitions, topic)
+	}
+	c.mu.Unlock()
+	c.applyPauses()
+}
+
+// PausePartitions pauses the consumption of the given partitions.
+func (c *consumerGroup) PausePartitions(partitions map[string][]int32) {
+	c.mu.Lock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			c.pausedPartitions.add(topic, p)
+		}
+	}
+	c.mu.Unlock()
+	c.applyPauses()
+}
+
+// ResumePartitions resumes the consumption of the given partitions. Partitions
+// of a topic paused as a whole stay paused until the topic is resumed.
+func (c *consumerGroup) ResumePartitions(partitions map[string][]int32) {
+	c.mu.Lock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			c.pausedPartitions.remove(topic, p)
+		}
+	}
+	c.mu.Unlock()
+	c.applyPauses()
+}
+
+// State returns the consumption state of the consumer group.
+func (c *consumerGroup) State() ConsumerState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]string, 0, len(c.pausedTopics))
+	for topic := range c.pausedTopics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	var lag []PartitionLag
+	if c.lagMonitor != nil {
+		lag = c.lagMonitor.Lags()
+	}
+	return ConsumerState{
+		Group:            c.cfg.Group,
+		MemberID:         c.memberID,
+		GenerationID:     c.generationID,
+		Assigned:         c.assigned.toMap(),
+		Paused:           c.paused.toMap(),
+		PausedTopics:     topics,
+		PausedPartitions: c.pausedPartitions.toMap(),
+		Lag:              lag,
+	}
+}
+
+// shouldPause reports whether the partition is paused by topic, individually
+// or while a retried message is delayed.
+func (c *consumerGroup) shouldPause(topic string, partition int32) bool {
+	return c.pausedTopics[topic] || c.pausedPartitions.contains(topic, partition) || c.delayed.contains(topic, partition)
+}
+
+// applyPauses pauses and resumes the assigned partitions according to the
+// requested state.
+func (c *consumerGroup) applyPauses() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pause := make(partitionSet)
+	resume := make(partitionSet)
+	for topic, partitions := range c.assigned {
+		for p := range partitions {
+			should := c.shouldPause(topic, p)
+			switch {
+			case should && !c.paused.contains(topic, p):
+				pause.add(topic, p)
+				c.paused.add(topic, p)
+			case !should && c.paused.contains(topic, p):
+				resume.add(topic, p)
+				c.paused.remove(topic, p)
+			}
+		}
+	}
+	if c.client == nil {
+		return
+	}
+	if len(pause) > 0 {
+		c.client.Pause(pause.toMap())
+	}
+	if len(resume) > 0 {
+		c.client.Resume(resume.toMap())
+	}
+}
+
+func (c *consumerGroup) sessionStarted(session sarama.ConsumerGroupSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.memberID = session.MemberID()
+	c.generationID = session.GenerationID()
+	c.assigned = newPartitionSet(session.Claims())
+	c.paused = make(partitionSet)
+	c.delayed = make(partitionSet)
+}
+
+// claimStarted pauses the partition if it should be paused. sarama creates
+// the partition consumers after the session setup, so pauses requested before
+// the claim started are applied here.
+func (c *consumerGroup) claimStarted(topic string, partition int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.assigned.add(topic, partition)
+	if !c.shouldPause(topic, partition) {
+		return
+	}
+	c.paused.add(topic, partition)
+	if c.client != nil {
+		c.client.Pause(map[string][]int32{topic: {partition}})
+	}
+}
+
+// delayStarted pauses the partition while the retried message is not due.
+func (c *consumerGroup) delayStarted(topic string, partition int32) {
+	c.mu.Lock()
+	c.delayed.add(topic, partition)
+	c.mu.Unlock()
+	c.applyPauses()
+}
+
+// delayEnded resumes the partition unless it is paused otherwise.
+func (c *consumerGroup) delayEnded(topic string, partition int32) {
+	c.mu.Lock()
+	c.delayed.remove(topic, partition)
+	c.mu.Unlock()
+	c.applyPauses()
+}
+
+func (c *consumerGroup) sessionEnded(sarama.ConsumerGroupSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.assigned = make(partitionSet)
+	c.paused = make(partitionSet)
+	c.delayed = make(partitionSet)
+}
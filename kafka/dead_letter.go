@@ -0,0 +1,172 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Headers added to the messages republished by the framework.
+const (
+	// HeaderError error message of the last failed attempt.
+	HeaderError = "x-sterna-error"
+	// HeaderSourceTopic topic the message was originally consumed from.
+	HeaderSourceTopic = "x-sterna-source-topic"
+	// HeaderSourcePartition partition the message was originally consumed from.
+	HeaderSourcePartition = "x-sterna-source-partition"
+	// HeaderSourceOffset offset of the message in the source partition.
+	HeaderSourceOffset = "x-sterna-source-offset"
+	// HeaderAttempt number of attempts made to process the message.
+	HeaderAttempt = "x-sterna-attempt"
+	// HeaderTimestamp time the message was republished, in RFC 3339 format.
+	HeaderTimestamp = "x-sterna-timestamp"
+
+	headerPrefix = "x-sterna-"
+
+	deadLetterSuffix = ".dlq"
+)
+
+// DeadLetterPolicy republishes the messages which could not be decoded or
+// handled to a dead-letter topic and commits their offsets. Failed publishes
+// are retried with the RepublishBackoff of the consumer configurations.
+type DeadLetterPolicy struct {
+	// Topic dead-letter topic. Defaults to "<source topic>.dlq".
+	Topic string
+	// Producer producer used to republish the messages. Not required with
+	// Transactional, which republishes them in its transactions.
+	Producer Producer
+}
+
+// topic returns the dead-letter topic of the given source topic.
+func (d *DeadLetterPolicy) topic(source string) string {
+	if d.Topic != "" {
+		return d.Topic
+	}
+	return source + deadLetterSuffix
+}
+
+// publish republishes the original bytes of the message with the failure details in the headers.
+func (d *DeadLetterPolicy) publish(msg *Message, cause error) error {
+	_, _, err := d.Producer.ProduceRaw(republished(msg, d.topic(sourceTopic(msg)), cause))
+	return err
+}
+
+// republished creates a message with the original key, value and headers of
+// msg for the given topic. The source of the message is kept if the message
+// was already republished.
+func republished(msg *Message, topic string, cause error) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+	for _, h := range msg.Headers {
+		if h != nil && !strings.HasPrefix(string(h.Key), headerPrefix) {
+			headers = append(headers, *h)
+		}
+	}
+	headers = append(headers,
+		header(HeaderError, cause.Error()),
+		header(HeaderSourceTopic, sourceTopic(msg)),
+		header(HeaderSourcePartition, headerOrDefault(msg, HeaderSourcePartition, strconv.FormatInt(int64(msg.Partition), 10))),
+		header(HeaderSourceOffset, headerOrDefault(msg, HeaderSourceOffset, strconv.FormatInt(msg.Offset, 10))),
+		header(HeaderAttempt, strconv.Itoa(attempts(msg)+1)),
+		header(HeaderTimestamp, time.Now().UTC().Format(time.RFC3339)),
+	)
+	pm := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(msg.RawValue),
+		Headers: headers,
+	}
+	if msg.RawKey != nil {
+		pm.Key = sarama.ByteEncoder(msg.RawKey)
+	}
+	return pm
+}
+
+// sourceTopic returns the topic the message was originally consumed from.
+func sourceTopic(msg *Message) string {
+	return headerOrDefault(msg, HeaderSourceTopic, msg.Topic)
+}
+
+// attempts returns the number of attempts made before this delivery of the message.
+func attempts(msg *Message) int {
+	n, err := strconv.Atoi(headerOrDefault(msg, HeaderAttempt, "0"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func headerOrDefault(msg *Message, key, def string) string {
+	if v, ok := msg.Header(key); ok {
+		return string(v)
+	}
+	return def
+}
+
+func header(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+}
+
+// handleFailure handles a message which could not be decoded or handled and
+// reports whether its offset should be committed. The message is republished
+// to a retry topic while attempts are left and dead-lettered afterwards, if
+// the policies are configured. Otherwise the ConsumerErrorHandler decides
+// whether the message is committed. Publishing is retried until it succeeds
+// or the session ends; in the latter case the message is not committed and
+// will be redelivered.
+func (c *ConsumerGroupHandler) handleFailure(ctx context.Context, msg *Message, cause error) (commit bool) {
+	partition := partitionLabel(msg.Partition)
+	if c.cfg.Retry != nil {
+		if delay, ok := c.cfg.Retry.delay(msg); ok {
+			if !c.republish(ctx, msg, "retry", func() error { return c.cfg.Retry.publish(msg, delay, cause) }) {
+				return false
+			}
+			c.cfg.Logger.WithError(cause).Warnf("Message published to the retry topic. topic = %s, partition = %d, offset = %d, delay = %v", msg.ConsumedTopic, msg.Partition, msg.Offset, delay)
+			c.metrics.errorDecisions.Inc(msg.ConsumedTopic, partition, decisionRetry)
+			return true
+		}
+	}
+	if c.cfg.DeadLetter == nil {
+		if c.cfg.ConsumerErrorHandler(cause) {
+			c.metrics.errorDecisions.Inc(msg.ConsumedTopic, partition, decisionCommit)
+			return true
+		}
+		c.metrics.errorDecisions.Inc(msg.ConsumedTopic, partition, decisionSkip)
+		return false
+	}
+	if !c.republish(ctx, msg, "dead-letter", func() error { return c.cfg.DeadLetter.publish(msg, cause) }) {
+		return false
+	}
+	c.cfg.Logger.WithError(cause).Warnf("Message published to the dead-letter topic. topic = %s, partition = %d, offset = %d", msg.ConsumedTopic, msg.Partition, msg.Offset)
+	c.metrics.errorDecisions.Inc(msg.ConsumedTopic, partition, decisionDeadLetter)
+	return true
+}
+
+// republish calls publish with exponential backoff, from RepublishBackoff up
+// to MaxRepublishBackoff, until it succeeds. It returns false if ctx is done
+// before.
+func (c *ConsumerGroupHandler) republish(ctx context.Context, msg *Message, kind string, publish func() error) bool {
+	backoff := c.cfg.RepublishBackoff
+	for {
+		err := publish()
+		if err == nil {
+			return true
+		}
+		c.cfg.Logger.WithError(err).Errorf("Unable to publish the message to the %s topic. topic = %s, partition = %d, offset = %d", kind, msg.ConsumedTopic, msg.Partition, msg.Offset)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.cfg.MaxRepublishBackoff {
+			backoff = c.cfg.MaxRepublishBackoff
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// defaultDedupTTL time the processed keys are kept by default.
+const defaultDedupTTL = 24 * time.Hour
+
+// DedupStore store of the idempotency keys of the processed messages. See the
+// dedup package for the in-memory and file-backed implementations.
+type DedupStore interface {
+	// Seen reports whether the key was added and has not expired.
+	Seen(ctx context.Context, key string) (bool, error)
+	// Add records the key until the ttl expires.
+	Add(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// IdempotencyKeyFunc extracts the idempotency key of a message. Messages with
+// an empty key are not deduplicated.
+type IdempotencyKeyFunc func(msg *Message) (key string, err error)
+
+// IdempotencyKeyHeader uses the value of the header with the given key.
+func IdempotencyKeyHeader(key string) IdempotencyKeyFunc {
+	return func(msg *Message) (string, error) {
+		v, _ := msg.Header(key)
+		return string(v), nil
+	}
+}
+
+// IdempotencyKeyOffset uses the source topic, partition and offset of the
+// message, which identify a message across its redeliveries and retries.
+func IdempotencyKeyOffset() IdempotencyKeyFunc {
+	return func(msg *Message) (string, error) {
+		partition := headerOrDefault(msg, HeaderSourcePartition, strconv.FormatInt(int64(msg.Partition), 10))
+		offset := headerOrDefault(msg, HeaderSourceOffset, strconv.FormatInt(msg.Offset, 10))
+		return sourceTopic(msg) + "/" + partition + "/" + offset, nil
+	}
+}
+
+// IdempotencyKeyMessageKey uses the key of the message, prefixed by its
+// source topic. It only suits topics whose message keys identify the events;
+// when the key identifies an entity, every later event of the entity is
+// skipped until the key expires.
+func IdempotencyKeyMessageKey() IdempotencyKeyFunc {
+	return func(msg *Message) (string, error) {
+		if len(msg.RawKey) == 0 {
+			return "", nil
+		}
+		return sourceTopic(msg) + "/" + string(msg.RawKey), nil
+	}
+}
+
+// DedupPolicy skips the messages whose idempotency key was already
+// processed. Keys are added to the store once the handler succeeds.
+type DedupPolicy struct {
+	Store DedupStore
+	// Key extracts the idempotency key, e.g. an event id header with
+	// IdempotencyKeyHeader or IdempotencyKeyOffset. It is required.
+	Key IdempotencyKeyFunc
+	// TTL time the keys are kept. Defaults to 24 hours.
+	TTL time.Duration
+}
+
+// dedup returns the middleware skipping the duplicated messages.
+func (c *ConsumerGroupHandler) dedup(policy *DedupPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			key, err := policy.Key(msg)
+			if err != nil {
+				return fmt.Errorf("unable to get the idempotency key: %w", err)
+			}
+			if key == "" {
+				return next(ctx, msg)
+			}
+			seen, err := policy.Store.Seen(ctx, key)
+			if err != nil {
+				return fmt.Errorf("unable to check the idempotency key %s: %w", key, err)
+			}
+			if seen {
+				c.cfg.Logger.Debugf("Duplicated message skipped: key = %s, topic = %s, partition = %d, offset = %d", key, msg.ConsumedTopic, msg.Partition, msg.Offset)
+				c.metrics.duplicates.Inc(msg.ConsumedTopic, partitionLabel(msg.Partition))
+				// The handler is not called to acknowledge it in the CommitManual mode.
+				msg.Ack()
+				return nil
+			}
+			if err = next(ctx, msg); err != nil {
+				return err
+			}
+			if err = policy.Store.Add(ctx, key, policy.TTL); err != nil {
+				// The message is handled, it may be processed again if redelivered.
+				c.cfg.Logger.WithError(err).Errorf("Unable to store the idempotency key %s", key)
+			}
+			return nil
+		}
+	}
+}
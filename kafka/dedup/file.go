@@ -0,0 +1,193 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package dedup
+package dedup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minCompactLines number of lines of the log below which it is not compacted.
+const minCompactLines = 1024
+
+// FileStore store persisted in an append-only log, so the keys survive
+// restarts. Every line of the log is "<expiry in unix nanoseconds> <quoted key>".
+// The log is compacted, dropping the expired and overwritten keys, when it is
+// opened and whenever it doubles in size.
+type FileStore struct {
+	path    string
+	file    *os.File
+	entries map[string]time.Time
+	lines   int
+	// compactAt number of lines of the log at which it is compacted.
+	compactAt int
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+// OpenFileStore opens the store at the given path, creating it if needed.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, entries: make(map[string]time.Time), now: time.Now}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the non-expired keys of the log. A last line without a new line
+// was not completely written before a crash and is dropped; the compaction
+// following the load removes it from the log.
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	now := s.now()
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		text, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		expiry, key, err := parseLine(strings.TrimSuffix(text, "\n"))
+		if err != nil {
+			return fmt.Errorf("invalid line %d of %s: %s", line, s.path, err)
+		}
+		if expiry.After(now) {
+			s.entries[key] = expiry
+		} else {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func parseLine(line string) (expiry time.Time, key string, err error) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return expiry, "", fmt.Errorf("missing key")
+	}
+	ns, err := strconv.ParseInt(line[:i], 10, 64)
+	if err != nil {
+		return expiry, "", err
+	}
+	if key, err = strconv.Unquote(line[i+1:]); err != nil {
+		return expiry, "", err
+	}
+	return time.Unix(0, ns), key, nil
+}
+
+func formatLine(key string, expiry time.Time) string {
+	return strconv.FormatInt(expiry.UnixNano(), 10) + " " + strconv.Quote(key) + "\n"
+}
+
+// compact rewrites the log with the non-expired keys and reopens it for appending.
+func (s *FileStore) compact() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+	}
+	now := s.now()
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	s.lines = 0
+	for key, expiry := range s.entries {
+		if !expiry.After(now) {
+			delete(s.entries, key)
+			continue
+		}
+		if _, err = w.WriteString(formatLine(key, expiry)); err != nil {
+			break
+		}
+		s.lines++
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	s.compactAt = 2 * s.lines
+	if s.compactAt < minCompactLines {
+		s.compactAt = minCompactLines
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	return err
+}
+
+// Seen reports whether the key was added and has not expired.
+func (s *FileStore) Seen(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.entries[key]
+	return ok && expiry.After(s.now()), nil
+}
+
+// Add records the key until the ttl expires and syncs the log.
+func (s *FileStore) Add(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("file store %s is closed", s.path)
+	}
+	expiry := s.now().Add(ttl)
+	if _, err := s.file.WriteString(formatLine(key, expiry)); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.entries[key] = expiry
+	s.lines++
+	if s.lines >= s.compactAt {
+		return s.compact()
+	}
+	return nil
+}
+
+// Close closes the log.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
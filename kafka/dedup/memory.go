@@ -0,0 +1,82 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package dedup provides the stores of the processed message keys used by the
+// deduplication of the kafka consumers.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	expires time.Time
+}
+
+// MemoryStore in-memory store keeping the most recently added keys.
+type MemoryStore struct {
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewMemoryStore creates a store of up to capacity keys. The least recently
+// added keys are evicted when the store is full.
+func NewMemoryStore(capacity int) *MemoryStore {
+	return &MemoryStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+// Seen reports whether the key was added and has not expired.
+func (s *MemoryStore) Seen(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if !s.now().Before(el.Value.(*entry).expires) {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Add records the key until the ttl expires.
+func (s *MemoryStore) Add(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := s.now().Add(ttl)
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*entry).expires = expires
+		s.lru.MoveToFront(el)
+		return nil
+	}
+	s.entries[key] = s.lru.PushFront(&entry{key: key, expires: expires})
+	for s.capacity > 0 && s.lru.Len() > s.capacity {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).key)
+	}
+	return nil
+}
+
+// Len returns the number of keys in the store, including the expired ones not evicted yet.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
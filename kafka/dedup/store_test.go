@@ -0,0 +1,140 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package dedup
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Unix(1000, 0)}
+	s := NewMemoryStore(2)
+	s.now = c.Now
+
+	_ = s.Add(ctx, "a", time.Minute)
+	_ = s.Add(ctx, "b", time.Hour)
+	_ = s.Add(ctx, "c", time.Hour)
+	if seen, _ := s.Seen(ctx, "a"); seen {
+		t.Errorf("Expected the least recently added key to be evicted")
+	}
+	if seen, _ := s.Seen(ctx, "b"); !seen {
+		t.Errorf("Expected b to be seen")
+	}
+	c.now = c.now.Add(2 * time.Hour)
+	if seen, _ := s.Seen(ctx, "c"); seen {
+		t.Errorf("Expected c to be expired")
+	}
+	if s.Len() != 1 {
+		t.Errorf("Expected the expired key to be removed, got %d keys", s.Len())
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	c := &clock{now: time.Unix(1000, 0)}
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	s.now = c.Now
+	_ = s.Add(ctx, "short", time.Minute)
+	_ = s.Add(ctx, "long key\nwith a new line", time.Hour)
+	if seen, _ := s.Seen(ctx, "short"); !seen {
+		t.Errorf("Expected short to be seen")
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	// The keys survive the restart and the expired ones are compacted away.
+	c.now = c.now.Add(30 * time.Minute)
+	s = &FileStore{path: path, entries: make(map[string]time.Time), now: c.Now}
+	if err = s.load(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err = s.compact(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer s.Close()
+	if seen, _ := s.Seen(ctx, "long key\nwith a new line"); !seen {
+		t.Errorf("Expected the key to survive the restart")
+	}
+	if seen, _ := s.Seen(ctx, "short"); seen {
+		t.Errorf("Expected short to be expired")
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("Expected 1 line after the compaction, got %d", lines)
+	}
+}
+
+func TestFileStore_Compaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer s.Close()
+	for i := 0; i < minCompactLines+10; i++ {
+		_ = s.Add(ctx, fmt.Sprintf("key-%d", i%10), time.Hour)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines > 20 {
+		t.Errorf("Expected the log to be compacted, got %d lines", lines)
+	}
+	if seen, _ := s.Seen(ctx, "key-9"); !seen {
+		t.Errorf("Expected key-9 to be seen after the compaction")
+	}
+}
+
+func TestFileStore_PartialLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	_ = s.Add(ctx, "a", time.Hour)
+	_ = s.Close()
+	// A crash while writing the next line leaves it incomplete.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = f.WriteString(`1234 "trunc`)
+	_ = f.Close()
+
+	if s, err = OpenFileStore(path); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer s.Close()
+	if seen, _ := s.Seen(ctx, "a"); !seen {
+		t.Errorf("Expected a to survive the restart")
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "trunc") {
+		t.Errorf("Expected the partial line to be removed, got %q", data)
+	}
+
+	// Complete lines which can not be parsed are still rejected.
+	if err = os.WriteFile(path, []byte("garbage\n"), 0o600); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if _, err = OpenFileStore(path); err == nil {
+		t.Errorf("Expected the invalid line to be rejected")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/kafka/dedup"
+)
+
+func TestConsumerGroupHandler_Dedup(t *testing.T) {
+	var handled []string
+	failed := false
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Dedup = &DedupPolicy{Store: dedup.NewMemoryStore(100), Key: IdempotencyKeyOffset()}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		if msg.Value == "c" && !failed {
+			failed = true
+			return errors.New("unable to process")
+		}
+		handled = append(handled, msg.Value.(string))
+		return nil
+	}
+	cfg.ConsumerErrorHandler = func(err error) bool { return false }
+	handler := getConsumerGroupHandler(cfg)
+
+	// The first attempt of c fails, so it is not deduplicated when redelivered.
+	for _, values := range [][]string{{"a", "b", "c"}, {"a", "b", "c"}} {
+		if err := handler.ConsumeClaim(newMockSession(), newMockClaim("orders", 0, values...)); err != nil {
+			t.Fatalf("Found error %s", err)
+		}
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(handled, expected) {
+		t.Errorf("Expected handled messages %v, got %v", expected, handled)
+	}
+}
+
+func TestConsumerGroupHandler_DedupManualCommit(t *testing.T) {
+	var handled []string
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Dedup = &DedupPolicy{Store: dedup.NewMemoryStore(100), Key: IdempotencyKeyMessageKey()}
+	cfg.CommitMode = CommitManual
+	cfg.CommitInterval = time.Hour
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		handled = append(handled, msg.Value.(string))
+		msg.Ack()
+		return nil
+	}
+	handler := getConsumerGroupHandler(cfg)
+	if err := handler.ConsumeClaim(newMockSession(), newMockClaim("orders", 0, "a")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	// The duplicated a is skipped but still acknowledged, so it is not redelivered.
+	session := newMockSession()
+	if err := handler.ConsumeClaim(session, newMockClaim("orders", 0, "b", "a")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(handled, expected) {
+		t.Errorf("Expected handled messages %v, got %v", expected, handled)
+	}
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1, 2}) {
+		t.Errorf("Expected offsets [1 2] to be marked, got %v", session.markedOffsets())
+	}
+}
+
+func TestIdempotencyKeyOffset(t *testing.T) {
+	key := IdempotencyKeyOffset()
+	msg := &Message{Topic: "orders", Partition: 2, Offset: 42}
+	if k, _ := key(msg); k != "orders/2/42" {
+		t.Errorf("Expected orders/2/42, got %s", k)
+	}
+	// Retried messages keep the key of the original message.
+	retried := &Message{Topic: "orders.retry.5s", Offset: 7, Headers: []*sarama.RecordHeader{
+		{Key: []byte(HeaderSourceTopic), Value: []byte("orders")},
+		{Key: []byte(HeaderSourcePartition), Value: []byte("2")},
+		{Key: []byte(HeaderSourceOffset), Value: []byte("42")},
+	}}
+	if k, _ := key(retried); k != "orders/2/42" {
+		t.Errorf("Expected orders/2/42, got %s", k)
+	}
+
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Dedup = &DedupPolicy{Store: dedup.NewMemoryStore(100)}
+	var errs ValidationErrors
+	if err := cfg.validate(); !errors.As(err, &errs) || !errs.Has("Dedup.Key") {
+		t.Errorf("Expected an error of Dedup.Key, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ package kafka
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/Shopify/sarama"
 )
@@ -25,3 +26,26 @@ func (aeb *defaultEncoderBuilder) Build(_ string, data interface{}) sarama.Encod
 	se := sarama.StringEncoder(string(binaryMsg))
 	return &se
 }
+
+// DefaultKeyEncoder creates a KeyEncoder which sends strings and bytes as they
+// are and the other keys as JSON.
+func DefaultKeyEncoder() KeyEncoder {
+	return func(key interface{}) (sarama.Encoder, error) {
+		switch k := key.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return sarama.StringEncoder(k), nil
+		case []byte:
+			return sarama.ByteEncoder(k), nil
+		case sarama.Encoder:
+			return k, nil
+		default:
+			data, err := json.Marshal(k)
+			if err != nil {
+				return nil, fmt.Errorf("unable to encode the key: %w", err)
+			}
+			return sarama.ByteEncoder(data), nil
+		}
+	}
+}
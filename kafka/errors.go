@@ -0,0 +1,58 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError validation error of a single field of the configurations. It is
+// also the error of a key of the configuration files, see config.FieldError.
+type FieldError struct {
+	// Key field, e.g. Brokers, or configuration key, e.g. kafka.brokers.
+	Key     string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// ValidationErrors all the validation errors of the configurations.
+type ValidationErrors []*FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("invalid configurations: %s", strings.Join(msgs, "; "))
+}
+
+// Has reports whether there is an error of the given field or key.
+func (v ValidationErrors) Has(key string) bool {
+	for _, e := range v {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds an error of the field.
+func (v *ValidationErrors) add(field, format string, args ...interface{}) {
+	*v = append(*v, &FieldError{Key: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns nil if there is no error.
+func (v ValidationErrors) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
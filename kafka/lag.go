@@ -0,0 +1,227 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+// defaultLagInterval interval of the lag checks by default.
+const defaultLagInterval = 30 * time.Second
+
+// PartitionLag lag of the consumer group in a partition.
+type PartitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Committed committed offset of the group, -1 if there is none.
+	Committed int64 `json:"committed"`
+	// HighWaterMark offset of the next message produced to the partition.
+	HighWaterMark int64 `json:"high_water_mark"`
+	// Lag number of messages not consumed yet.
+	Lag int64 `json:"lag"`
+	// CatchUp estimated time to consume the lag at the rates observed since
+	// the previous check. It is -1 if the group is not catching up or the
+	// rates are not known yet.
+	CatchUp time.Duration `json:"catch_up"`
+	// CheckedAt time of the check.
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// LagPolicy monitors the lag of the consumer group.
+type LagPolicy struct {
+	// Interval interval of the checks. Defaults to 30 seconds.
+	Interval time.Duration
+	// Threshold lag above which OnLagExceeded is called. Zero disables the callback.
+	Threshold int64
+	// OnLagExceeded is called after every check with the partitions whose
+	// lag exceeds the threshold, e.g. to alert or to autoscale.
+	OnLagExceeded func(lags []PartitionLag)
+	// Offset initial offset of the group, which the lag of the partitions
+	// without a committed offset is measured from. Defaults to Newest. The
+	// consumer group sets its own ConsumerConfig.Offset.
+	Offset Offset
+}
+
+// Lag returns the lag of the consumer group in the partitions of the topics.
+// The lag of a partition without a committed offset is measured from the
+// initial offset of the group: the whole partition with Oldest, none with
+// Newest.
+func (a *OffsetAdmin) Lag(group string, topics []string, initial Offset) ([]PartitionLag, error) {
+	requested := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		requested[topic] = nil
+	}
+	partitions, err := a.partitions(requested)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := a.plan(OffsetReset{Group: group, To: ResetLatest}, partitions)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	lags := make([]PartitionLag, 0, len(changes))
+	for _, c := range changes {
+		lag := PartitionLag{
+			Topic:         c.Topic,
+			Partition:     c.Partition,
+			Committed:     c.Current,
+			HighWaterMark: c.Target,
+			CatchUp:       -1,
+			CheckedAt:     now,
+		}
+		lag.Lag = lag.HighWaterMark - lag.Committed
+		if lag.Committed < 0 {
+			// Nothing committed yet, the group starts from its initial offset.
+			lag.Lag = 0
+			if initial == Oldest {
+				if oldest, err := a.client.GetOffset(c.Topic, c.Partition, sarama.OffsetOldest); err == nil {
+					lag.Lag = lag.HighWaterMark - oldest
+				}
+			}
+		}
+		if lag.Lag < 0 {
+			lag.Lag = 0
+		}
+		lags = append(lags, lag)
+	}
+	return lags, nil
+}
+
+// LagMonitor checks the lag of a consumer group periodically and publishes
+// it as metrics.
+type LagMonitor struct {
+	admin    *OffsetAdmin
+	group    string
+	topics   []string
+	policy   LagPolicy
+	lag      *metrics.Gauge
+	catchUp  *metrics.Gauge
+	lags     []PartitionLag
+	previous map[string]map[int32]PartitionLag
+	mu       sync.RWMutex
+}
+
+// NewLagMonitor creates a lag monitor of the group in the given topics. The
+// default registry is used if registry is nil.
+func NewLagMonitor(admin *OffsetAdmin, group string, topics []string, policy LagPolicy, registry *metrics.Registry) *LagMonitor {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = defaultLagInterval
+	}
+	if policy.Offset == "" {
+		policy.Offset = Newest
+	}
+	return &LagMonitor{
+		admin:  admin,
+		group:  group,
+		topics: topics,
+		policy: policy,
+		lag: registry.Gauge("sterna_kafka_consumer_lag",
+			"Number of messages not consumed yet by the consumer group.", "group", "topic", "partition"),
+		catchUp: registry.Gauge("sterna_kafka_consumer_lag_catch_up_seconds",
+			"Estimated time to consume the lag, -1 if the group is not catching up.", "group", "topic", "partition"),
+		previous: make(map[string]map[int32]PartitionLag),
+	}
+}
+
+// Run checks the lag every interval until ctx is cancelled. Check errors are
+// returned through the errors callback, if given, and do not stop the monitor.
+func (m *LagMonitor) Run(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(m.policy.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Check(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the lag once, publishes the metrics and calls OnLagExceeded.
+// The metrics of the partitions which are not reported anymore are deleted.
+func (m *LagMonitor) Check() ([]PartitionLag, error) {
+	lags, err := m.admin.Lag(m.group, m.topics, m.policy.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check the lag of %s: %w", m.group, err)
+	}
+	var exceeded []PartitionLag
+	m.mu.Lock()
+	current := make(map[string]map[int32]PartitionLag)
+	for i := range lags {
+		lag := &lags[i]
+		if prev, ok := m.previous[lag.Topic][lag.Partition]; ok {
+			lag.CatchUp = estimateCatchUp(prev, *lag)
+		}
+		if current[lag.Topic] == nil {
+			current[lag.Topic] = make(map[int32]PartitionLag)
+		}
+		current[lag.Topic][lag.Partition] = *lag
+		partition := partitionLabel(lag.Partition)
+		m.lag.Set(float64(lag.Lag), m.group, lag.Topic, partition)
+		catchUp := lag.CatchUp.Seconds()
+		if lag.CatchUp < 0 {
+			catchUp = -1
+		}
+		m.catchUp.Set(catchUp, m.group, lag.Topic, partition)
+		if m.policy.Threshold > 0 && lag.Lag > m.policy.Threshold {
+			exceeded = append(exceeded, *lag)
+		}
+	}
+	for topic, partitions := range m.previous {
+		for p := range partitions {
+			if _, ok := current[topic][p]; !ok {
+				m.lag.Delete(m.group, topic, partitionLabel(p))
+				m.catchUp.Delete(m.group, topic, partitionLabel(p))
+			}
+		}
+	}
+	m.previous = current
+	m.lags = lags
+	m.mu.Unlock()
+	if len(exceeded) > 0 && m.policy.OnLagExceeded != nil {
+		m.policy.OnLagExceeded(exceeded)
+	}
+	return lags, nil
+}
+
+// Lags returns the lags of the last check.
+func (m *LagMonitor) Lags() []PartitionLag {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]PartitionLag(nil), m.lags...)
+}
+
+// estimateCatchUp estimates the time to consume the lag from the consumption
+// and production rates between the two checks.
+func estimateCatchUp(prev, cur PartitionLag) time.Duration {
+	if cur.Lag == 0 {
+		return 0
+	}
+	elapsed := cur.CheckedAt.Sub(prev.CheckedAt).Seconds()
+	if elapsed <= 0 || prev.Committed < 0 || cur.Committed < 0 {
+		return -1
+	}
+	consumed := float64(cur.Committed-prev.Committed) / elapsed
+	produced := float64(cur.HighWaterMark-prev.HighWaterMark) / elapsed
+	if consumed <= produced {
+		return -1
+	}
+	return time.Duration(float64(cur.Lag) / (consumed - produced) * float64(time.Second))
+}
@@ -0,0 +1,155 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+func TestLagMonitor(t *testing.T) {
+	broker := newOffsetsBroker(t, "Stable")
+	defer broker.Close()
+	admin, err := NewOffsetAdmin(ClientConfig{Brokers: []string{broker.Addr()}, Version: Version_2_1_1})
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer admin.Close()
+
+	var exceeded []PartitionLag
+	registry := metrics.NewRegistry()
+	monitor := NewLagMonitor(admin, "group", []string{"orders"}, LagPolicy{
+		Threshold:     20,
+		OnLagExceeded: func(lags []PartitionLag) { exceeded = lags },
+	}, registry)
+	lags, err := monitor.Check()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if len(lags) != 2 || lags[0].Lag != 10 || lags[1].Lag != 30 || lags[0].CatchUp != -1 {
+		t.Errorf("Unexpected lags %+v", lags)
+	}
+	if len(exceeded) != 1 || exceeded[0].Partition != 1 {
+		t.Errorf("Expected the lag of partition 1 to exceed the threshold, got %+v", exceeded)
+	}
+	buf := &bytes.Buffer{}
+	_ = registry.WriteText(buf)
+	line := `sterna_kafka_consumer_lag{group="group",topic="orders",partition="1"} 30`
+	if !strings.Contains(buf.String(), line) {
+		t.Errorf("Expected metrics to contain %s, got\n%s", line, buf.String())
+	}
+
+	cg := newTestConsumerGroup(&mockClient{})
+	cg.lagMonitor = monitor
+	rec := httptest.NewRecorder()
+	NewAdminHandler(cg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lag", nil))
+	var served []PartitionLag
+	if err = json.NewDecoder(rec.Body).Decode(&served); err != nil || len(served) != 2 {
+		t.Errorf("Expected the lags to be served, got %v, %v", served, err)
+	}
+}
+
+func TestLagMonitor_InitialOffset(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	// Nothing is committed in partition 1.
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()).
+			SetLeader("orders", 1, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetNewest, 100).
+			SetOffset("orders", 1, sarama.OffsetOldest, 0).
+			SetOffset("orders", 1, sarama.OffsetNewest, 50),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "orders", 0, 90, "", sarama.ErrNoError).
+			SetOffset("group", "orders", 1, -1, "", sarama.ErrNoError),
+	})
+	admin, err := NewOffsetAdmin(ClientConfig{Brokers: []string{broker.Addr()}, Version: Version_2_1_1})
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer admin.Close()
+
+	for offset, expected := range map[Offset]int64{Newest: 0, Oldest: 50, "": 0} {
+		var exceeded []PartitionLag
+		registry := metrics.NewRegistry()
+		monitor := NewLagMonitor(admin, "group", []string{"orders"}, LagPolicy{
+			Threshold:     20,
+			Offset:        offset,
+			OnLagExceeded: func(lags []PartitionLag) { exceeded = lags },
+		}, registry)
+		lags, err := monitor.Check()
+		if err != nil {
+			t.Fatalf("Found error %s", err)
+		}
+		if len(lags) != 2 || lags[1].Committed != -1 || lags[1].Lag != expected {
+			t.Errorf("Expected a lag of %d in partition 1 with offset %q, got %+v", expected, offset, lags)
+		}
+		if (len(exceeded) > 0) != (expected > 20) {
+			t.Errorf("Unexpected exceeded lags with offset %q: %+v", offset, exceeded)
+		}
+	}
+}
+
+func TestLagMonitor_DeletesStaleMetrics(t *testing.T) {
+	broker := newOffsetsBroker(t, "Stable")
+	defer broker.Close()
+	admin, err := NewOffsetAdmin(ClientConfig{Brokers: []string{broker.Addr()}, Version: Version_2_1_1})
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer admin.Close()
+	registry := metrics.NewRegistry()
+	monitor := NewLagMonitor(admin, "group", []string{"orders"}, LagPolicy{}, registry)
+	// payments was reported by a previous check.
+	monitor.previous["payments"] = map[int32]PartitionLag{0: {Topic: "payments", Lag: 5}}
+	monitor.lag.Set(5, "group", "payments", "0")
+	monitor.catchUp.Set(-1, "group", "payments", "0")
+	if _, err = monitor.Check(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	_ = registry.WriteText(buf)
+	if strings.Contains(buf.String(), `topic="payments"`) {
+		t.Errorf("Expected the metrics of payments to be deleted, got\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `sterna_kafka_consumer_lag{group="group",topic="orders",partition="1"} 30`) {
+		t.Errorf("Expected the metrics of orders, got\n%s", buf.String())
+	}
+	if _, ok := monitor.previous["payments"]; ok {
+		t.Errorf("Expected payments to be forgotten")
+	}
+}
+
+func TestEstimateCatchUp(t *testing.T) {
+	start := time.Unix(1000, 0)
+	prev := PartitionLag{Committed: 100, HighWaterMark: 1100, Lag: 1000, CheckedAt: start}
+	// Consumed 300 and produced 100 messages in 10 seconds: 20 msg/s net.
+	cur := PartitionLag{Committed: 400, HighWaterMark: 1200, Lag: 800, CheckedAt: start.Add(10 * time.Second)}
+	if catchUp := estimateCatchUp(prev, cur); catchUp != 40*time.Second {
+		t.Errorf("Expected 40s, got %v", catchUp)
+	}
+	// Falling behind.
+	cur = PartitionLag{Committed: 200, HighWaterMark: 1300, Lag: 1100, CheckedAt: start.Add(10 * time.Second)}
+	if catchUp := estimateCatchUp(prev, cur); catchUp != -1 {
+		t.Errorf("Expected -1, got %v", catchUp)
+	}
+}
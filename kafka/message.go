@@ -0,0 +1,93 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Message consumed message with the decoded key and value and its metadata.
+// It is also the message given to Producer.ProduceMessage.
+type Message struct {
+	// Topic topic of the message. For a message consumed from a retry topic,
+	// it is the topic the message was originally consumed from.
+	Topic string
+	// ConsumedTopic topic the message was consumed from, with Partition and
+	// Offset. It is the retry topic for the retried messages.
+	ConsumedTopic string
+	Partition     int32
+	Offset        int64
+	Timestamp     time.Time
+	Headers       []*sarama.RecordHeader
+	// Key and Value decoded by the Decoder.
+	Key   interface{}
+	Value interface{}
+	// RawKey and RawValue bytes of the key and the value as consumed. When
+	// produced, they are sent as they are instead of Key and Value if set.
+	RawKey   []byte
+	RawValue []byte
+	// Schema subject the Value is encoded with by the EncoderBuilder when
+	// the message is produced.
+	Schema string
+
+	raw *sarama.ConsumerMessage
+	ack func()
+	// route route of the message resolved by the Router while decoding.
+	route *routing
+}
+
+// Handler handles the consumed messages. ctx is cancelled when the session
+// ends, e.g. when the partition is revoked by a rebalance. Retried messages
+// have the source topic in Message.Topic and the retry topic in
+// Message.ConsumedTopic.
+type Handler func(ctx context.Context, msg *Message) (err error)
+
+// CallbackHandler adapts a ConsumerCallback to a Handler.
+func CallbackHandler(callback ConsumerCallback) Handler {
+	return func(_ context.Context, msg *Message) error {
+		return callback(msg.Key, msg.Value)
+	}
+}
+
+func newMessage(cm *sarama.ConsumerMessage) *Message {
+	return &Message{
+		Topic:         cm.Topic,
+		ConsumedTopic: cm.Topic,
+		Partition:     cm.Partition,
+		Offset:        cm.Offset,
+		Timestamp:     cm.Timestamp,
+		Headers:       cm.Headers,
+		RawKey:        cm.Key,
+		RawValue:      cm.Value,
+		raw:           cm,
+	}
+}
+
+// Ack marks the message as consumed in the CommitManual mode. It is a no-op
+// in the other modes, where the messages are marked after they are handled.
+// Kafka keeps a single offset per partition, so acknowledging a message also
+// commits the earlier messages of its partition, acknowledged or not. With
+// Concurrency, the message is marked once every earlier message of the
+// partition is processed.
+func (m *Message) Ack() {
+	if m.ack != nil {
+		m.ack()
+	}
+}
+
+// Header returns the value of the first header with the given key.
+func (m *Message) Header(key string) (value []byte, ok bool) {
+	for _, h := range m.Headers {
+		if h != nil && string(h.Key) == key {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
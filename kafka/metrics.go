@@ -0,0 +1,81 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"strconv"
+
+	"github.com/udayangaac/sterna/metrics"
+)
+
+const (
+	decisionCommit     = "commit"
+	decisionSkip       = "skip"
+	decisionDeadLetter = "dead_letter"
+	decisionRetry      = "retry"
+
+	txnCommitted = "committed"
+	txnAborted   = "aborted"
+)
+
+// consumerMetrics metrics published by the consumer group.
+type consumerMetrics struct {
+	consumed       *metrics.Counter
+	decodeFailures *metrics.Counter
+	callbackErrors *metrics.Counter
+	errorDecisions *metrics.Counter
+	duplicates     *metrics.Counter
+	generation     *metrics.Gauge
+	rebalances     *metrics.Counter
+	transactions   *metrics.Counter
+}
+
+func newConsumerMetrics(registry *metrics.Registry) *consumerMetrics {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	return &consumerMetrics{
+		consumed: registry.Counter("sterna_kafka_consumer_messages_total",
+			"Number of messages consumed.", "topic", "partition"),
+		decodeFailures: registry.Counter("sterna_kafka_consumer_decode_failures_total",
+			"Number of messages which could not be decoded.", "topic", "partition"),
+		callbackErrors: registry.Counter("sterna_kafka_consumer_callback_errors_total",
+			"Number of errors returned by the consumer callback.", "topic", "partition"),
+		errorDecisions: registry.Counter("sterna_kafka_consumer_error_decisions_total",
+			"Decisions of the consumer error handler.", "topic", "partition", "decision"),
+		duplicates: registry.Counter("sterna_kafka_consumer_duplicates_total",
+			"Number of duplicated messages skipped.", "topic", "partition"),
+		generation: registry.Gauge("sterna_kafka_consumer_generation",
+			"Generation id of the current consumer group session.", "group"),
+		rebalances: registry.Counter("sterna_kafka_consumer_sessions_total",
+			"Number of consumer group sessions started after rebalances.", "group"),
+		transactions: registry.Counter("sterna_kafka_consumer_transactions_total",
+			"Number of transactions of the transactional consumer.", "group", "result"),
+	}
+}
+
+// producerMetrics metrics published by the producer.
+type producerMetrics struct {
+	sendDuration *metrics.Histogram
+	sendFailures *metrics.Counter
+}
+
+func newProducerMetrics(registry *metrics.Registry) *producerMetrics {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	return &producerMetrics{
+		sendDuration: registry.Histogram("sterna_kafka_producer_send_duration_seconds",
+			"Latency of sending messages.", nil, "topic"),
+		sendFailures: registry.Counter("sterna_kafka_producer_send_failures_total",
+			"Number of messages which could not be sent.", "topic"),
+	}
+}
+
+func partitionLabel(partition int32) string {
+	return strconv.FormatInt(int64(partition), 10)
+}
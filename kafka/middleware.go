@@ -0,0 +1,131 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/udayangaac/sterna/log"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+// Middleware wraps a Handler, e.g. to log, time or recover the handling of
+// the messages.
+type Middleware func(next Handler) Handler
+
+// chain wraps the handler with the middlewares. The first middleware is the
+// outermost one.
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// PanicError error returned by Recover for a panicking handler.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while handling the message: %v", e.Value)
+}
+
+// Recover converts the panics of the handler to *PanicError, which are handled
+// like the other handler errors.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Logging logs every message handled with its topic, partition and offset.
+// Successes are logged at debug level and failures at error level.
+func Logging(logger log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			l := logger.With("topic", msg.ConsumedTopic, "partition", msg.Partition, "offset", msg.Offset)
+			start := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				l.WithError(err).Errorf("Message handling failed in %v", time.Since(start))
+				return err
+			}
+			l.Debugf("Message handled in %v", time.Since(start))
+			return nil
+		}
+	}
+}
+
+// Timeout cancels the context of the handler after the timeout and returns
+// context.DeadlineExceeded if the handler has not returned by then. The
+// handler keeps running in the background until it returns, so it should
+// respect the cancellation of the context.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			type result struct {
+				err   error
+				panic interface{}
+			}
+			done := make(chan result, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						done <- result{panic: r}
+					}
+				}()
+				done <- result{err: next(ctx, msg)}
+			}()
+			select {
+			case r := <-done:
+				if r.panic != nil {
+					// Panic in the calling goroutine so Recover can handle it.
+					panic(r.panic)
+				}
+				return r.err
+			case <-ctx.Done():
+				return fmt.Errorf("handling the message of %s/%d at offset %d: %w", msg.ConsumedTopic, msg.Partition, msg.Offset, ctx.Err())
+			}
+		}
+	}
+}
+
+// Metrics records the duration of the handler by topic and result. The
+// default registry is used if registry is nil.
+func Metrics(registry *metrics.Registry) Middleware {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	duration := registry.Histogram("sterna_kafka_handler_duration_seconds",
+		"Duration of the message handler.", nil, "topic", "result")
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			result := "success"
+			if err != nil {
+				result = "error"
+			}
+			duration.Observe(time.Since(start).Seconds(), msg.Topic, result)
+			return err
+		}
+	}
+}
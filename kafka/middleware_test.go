@@ -0,0 +1,96 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udayangaac/sterna/metrics"
+)
+
+func TestConfig_Use(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg *Message) error {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+	cfg := newTestConfig(func(key, value interface{}) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	cfg.Use(trace("first"), trace("second"))
+	session := newMockSession()
+	if err := getConsumerGroupHandler(cfg).ConsumeClaim(session, newMockClaim("orders", 0, "a")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if expected := []string{"first", "second", "handler"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { panic("nil map") })
+	cfg.Use(Recover())
+	var handled error
+	cfg.ConsumerErrorHandler = func(err error) bool {
+		handled = err
+		return true
+	}
+	session := newMockSession()
+	if err := getConsumerGroupHandler(cfg).ConsumeClaim(session, newMockClaim("orders", 0, "a")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	var panicErr *PanicError
+	if !errors.As(handled, &panicErr) || panicErr.Value != "nil map" {
+		t.Errorf("Expected the panic to be converted to an error, got %v", handled)
+	}
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1}) {
+		t.Errorf("Expected offset 1 to be committed, got %v", session.markedOffsets())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	handler := Timeout(10 * time.Millisecond)(func(ctx context.Context, msg *Message) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err := handler(context.Background(), &Message{Topic: "orders"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	handler = Recover()(Timeout(time.Second)(func(ctx context.Context, msg *Message) error { panic("failed") }))
+	var panicErr *PanicError
+	if err := handler(context.Background(), &Message{Topic: "orders"}); !errors.As(err, &panicErr) {
+		t.Errorf("Expected the panic to be recovered, got %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	handler := Metrics(registry)(func(ctx context.Context, msg *Message) error {
+		return errors.New("unable to process")
+	})
+	_ = handler(context.Background(), &Message{Topic: "orders"})
+
+	buf := &bytes.Buffer{}
+	_ = registry.WriteText(buf)
+	line := `sterna_kafka_handler_duration_seconds_count{topic="orders",result="error"} 1`
+	if !strings.Contains(buf.String(), line) {
+		t.Errorf("Expected metrics to contain %s, got\n%s", line, buf.String())
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ResetTo position the committed offsets are reset to.
+type ResetTo string
+
+const (
+	// ResetEarliest resets to the oldest available offset.
+	ResetEarliest ResetTo = "earliest"
+	// ResetLatest resets to the end of the partitions.
+	ResetLatest ResetTo = "latest"
+	// ResetOffset resets to OffsetReset.Offset, bounded by the available offsets.
+	ResetOffset ResetTo = "offset"
+	// ResetTimestamp resets to the first offset with a timestamp at or after
+	// OffsetReset.Timestamp, or the end of the partition if there is none.
+	ResetTimestamp ResetTo = "timestamp"
+)
+
+// OffsetReset request to reset the committed offsets of a consumer group.
+type OffsetReset struct {
+	Group string
+	// Partitions partitions to reset by topic. All the partitions of a topic
+	// are reset if none is given.
+	Partitions map[string][]int32
+	To         ResetTo
+	Offset     int64
+	Timestamp  time.Time
+	// DryRun only plans the changes without committing them.
+	DryRun bool
+}
+
+// OffsetChange planned or committed change of the offset of a partition.
+type OffsetChange struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Current committed offset, -1 if the group has no committed offset.
+	Current int64 `json:"current"`
+	Target  int64 `json:"target"`
+}
+
+// OffsetAdmin manages the committed offsets of the consumer groups.
+type OffsetAdmin struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewOffsetAdmin connects to the brokers. Only the client settings of cfg,
+// such as the brokers, the version, TLS and SASL, are used.
+func NewOffsetAdmin(cfg ClientConfig) (*OffsetAdmin, error) {
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	config.Consumer.Return.Errors = true
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the client: %w", err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("error creating the cluster admin: %w", err)
+	}
+	return &OffsetAdmin{client: client, admin: admin}, nil
+}
+
+// ResetOffsets resets the committed offsets of the consumer group and returns
+// the changes, sorted by topic and partition. The consumer group must have no
+// active members unless it is a dry run.
+func (a *OffsetAdmin) ResetOffsets(reset OffsetReset) ([]OffsetChange, error) {
+	partitions, err := a.partitions(reset.Partitions)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := a.plan(reset, partitions)
+	if err != nil || reset.DryRun {
+		return changes, err
+	}
+	if err = a.checkInactive(reset.Group); err != nil {
+		return nil, err
+	}
+	return changes, a.commit(reset.Group, changes)
+}
+
+// partitions resolves the partitions of the topics without partitions.
+func (a *OffsetAdmin) partitions(requested map[string][]int32) (map[string][]int32, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("no topic to reset")
+	}
+	partitions := make(map[string][]int32, len(requested))
+	for topic, ps := range requested {
+		if len(ps) == 0 {
+			var err error
+			if ps, err = a.client.Partitions(topic); err != nil {
+				return nil, fmt.Errorf("unable to get the partitions of %s: %w", topic, err)
+			}
+		}
+		partitions[topic] = ps
+	}
+	return partitions, nil
+}
+
+// plan returns the current and the target offsets of the partitions.
+func (a *OffsetAdmin) plan(reset OffsetReset, partitions map[string][]int32) ([]OffsetChange, error) {
+	committed, err := a.admin.ListConsumerGroupOffsets(reset.Group, partitions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the offsets of %s: %w", reset.Group, err)
+	}
+	var changes []OffsetChange
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			change := OffsetChange{Topic: topic, Partition: p, Current: -1}
+			if block := committed.GetBlock(topic, p); block != nil {
+				if block.Err != sarama.ErrNoError {
+					return nil, fmt.Errorf("unable to get the offset of %s/%d: %w", topic, p, block.Err)
+				}
+				change.Current = block.Offset
+			}
+			if change.Target, err = a.target(reset, topic, p); err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Topic != changes[j].Topic {
+			return changes[i].Topic < changes[j].Topic
+		}
+		return changes[i].Partition < changes[j].Partition
+	})
+	return changes, nil
+}
+
+// target returns the offset the partition is reset to.
+func (a *OffsetAdmin) target(reset OffsetReset, topic string, partition int32) (int64, error) {
+	getOffset := func(time int64) (int64, error) {
+		offset, err := a.client.GetOffset(topic, partition, time)
+		if err != nil {
+			return 0, fmt.Errorf("unable to get the offsets of %s/%d: %w", topic, partition, err)
+		}
+		return offset, nil
+	}
+	switch reset.To {
+	case ResetEarliest:
+		return getOffset(sarama.OffsetOldest)
+	case ResetLatest:
+		return getOffset(sarama.OffsetNewest)
+	case ResetOffset:
+		oldest, err := getOffset(sarama.OffsetOldest)
+		if err != nil {
+			return 0, err
+		}
+		newest, err := getOffset(sarama.OffsetNewest)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case reset.Offset < oldest:
+			return oldest, nil
+		case reset.Offset > newest:
+			return newest, nil
+		}
+		return reset.Offset, nil
+	case ResetTimestamp:
+		offset, err := getOffset(reset.Timestamp.UnixNano() / int64(time.Millisecond))
+		if err != nil {
+			return 0, err
+		}
+		if offset < 0 {
+			// No message at or after the timestamp.
+			return getOffset(sarama.OffsetNewest)
+		}
+		return offset, nil
+	default:
+		return 0, fmt.Errorf("invalid reset position: %s", reset.To)
+	}
+}
+
+// checkInactive returns an error if the consumer group has active members,
+// which would overwrite the reset offsets.
+func (a *OffsetAdmin) checkInactive(group string) error {
+	groups, err := a.admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return fmt.Errorf("unable to describe %s: %w", group, err)
+	}
+	for _, g := range groups {
+		if g.State != "Empty" && g.State != "Dead" && g.State != "" {
+			return fmt.Errorf("consumer group %s is %s with %d members, stop the consumers before resetting the offsets", group, g.State, len(g.Members))
+		}
+	}
+	return nil
+}
+
+// commit commits the target offsets with an offset manager.
+func (a *OffsetAdmin) commit(group string, changes []OffsetChange) (err error) {
+	om, err := sarama.NewOffsetManagerFromClient(group, a.client)
+	if err != nil {
+		return fmt.Errorf("unable to create the offset manager: %w", err)
+	}
+	defer func() {
+		if closeErr := om.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+	poms := make([]sarama.PartitionOffsetManager, 0, len(changes))
+	defer func() {
+		for _, pom := range poms {
+			pom.AsyncClose()
+		}
+	}()
+	for _, change := range changes {
+		pom, err := om.ManagePartition(change.Topic, change.Partition)
+		if err != nil {
+			return fmt.Errorf("unable to manage %s/%d: %w", change.Topic, change.Partition, err)
+		}
+		poms = append(poms, pom)
+		// ResetOffset only moves the offset backwards and MarkOffset forwards.
+		pom.ResetOffset(change.Target, "")
+		pom.MarkOffset(change.Target, "")
+	}
+	om.Commit()
+	for _, pom := range poms {
+		select {
+		case err := <-pom.Errors():
+			return fmt.Errorf("unable to commit the offsets of %s: %w", group, err)
+		default:
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to the brokers.
+func (a *OffsetAdmin) Close() error {
+	return a.admin.Close()
+}
@@ -0,0 +1,120 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func newOffsetsBroker(t *testing.T, state string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	timestamp := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()).
+			SetLeader("orders", 1, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 10).
+			SetOffset("orders", 0, sarama.OffsetNewest, 100).
+			SetOffset("orders", 0, timestamp, 40).
+			SetOffset("orders", 1, sarama.OffsetOldest, 0).
+			SetOffset("orders", 1, sarama.OffsetNewest, 50).
+			SetOffset("orders", 1, timestamp, -1),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "orders", 0, 90, "", sarama.ErrNoError).
+			SetOffset("group", "orders", 1, 20, "", sarama.ErrNoError),
+		"DescribeGroupsRequest": sarama.NewMockDescribeGroupsResponse(t).
+			AddGroupDescription("group", &sarama.GroupDescription{GroupId: "group", State: state}),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+	return broker
+}
+
+func committedOffsets(broker *sarama.MockBroker) map[int32]int64 {
+	offsets := make(map[int32]int64)
+	for _, rr := range broker.History() {
+		req, ok := rr.Request.(*sarama.OffsetCommitRequest)
+		if !ok {
+			continue
+		}
+		for _, p := range []int32{0, 1} {
+			if offset, _, err := req.Offset("orders", p); err == nil {
+				offsets[p] = offset
+			}
+		}
+	}
+	return offsets
+}
+
+func TestOffsetAdmin_ResetOffsets(t *testing.T) {
+	broker := newOffsetsBroker(t, "Empty")
+	defer broker.Close()
+	admin, err := NewOffsetAdmin(ClientConfig{Brokers: []string{broker.Addr()}, Version: Version_2_1_1})
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer admin.Close()
+
+	reset := OffsetReset{
+		Group:      "group",
+		Partitions: map[string][]int32{"orders": nil},
+		To:         ResetTimestamp,
+		Timestamp:  time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		DryRun:     true,
+	}
+	changes, err := admin.ResetOffsets(reset)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	expected := []OffsetChange{
+		{Topic: "orders", Partition: 0, Current: 90, Target: 40},
+		{Topic: "orders", Partition: 1, Current: 20, Target: 50},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+	if offsets := committedOffsets(broker); len(offsets) != 0 {
+		t.Errorf("Expected nothing committed in a dry run, got %v", offsets)
+	}
+
+	reset.DryRun = false
+	if _, err = admin.ResetOffsets(reset); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if offsets := committedOffsets(broker); !reflect.DeepEqual(offsets, map[int32]int64{0: 40, 1: 50}) {
+		t.Errorf("Expected offsets 40 and 50 to be committed, got %v", offsets)
+	}
+
+	changes, err = admin.ResetOffsets(OffsetReset{Group: "group", Partitions: map[string][]int32{"orders": {0}}, To: ResetOffset, Offset: 5, DryRun: true})
+	if err != nil || len(changes) != 1 || changes[0].Target != 10 {
+		t.Errorf("Expected the offset to be bounded to 10, got %v, %v", changes, err)
+	}
+}
+
+func TestOffsetAdmin_ActiveGroup(t *testing.T) {
+	broker := newOffsetsBroker(t, "Stable")
+	defer broker.Close()
+	admin, err := NewOffsetAdmin(ClientConfig{Brokers: []string{broker.Addr()}, Version: Version_2_1_1})
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer admin.Close()
+
+	_, err = admin.ResetOffsets(OffsetReset{Group: "group", Partitions: map[string][]int32{"orders": nil}, To: ResetEarliest})
+	if err == nil || !strings.Contains(err.Error(), "stop the consumers") {
+		t.Errorf("Expected the reset of an active group to fail, got %v", err)
+	}
+}
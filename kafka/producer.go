@@ -7,6 +7,8 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,53 +17,217 @@ import (
 
 // Producer kafka message producer interface.
 type Producer interface {
-	// Produce produce the kafka message to the given topic.
+	// Produce produce the kafka message to the given topic. The key is encoded
+	// by the KeyEncoder and the value by the EncoderBuilder with the schema subject.
+	// A nil value is sent as a tombstone, without a value, instead of being
+	// encoded. It returns -1, -1 on errors.
 	Produce(topic string, schema string, key interface{}, value interface{}) (partition int32, offset int64, err error)
+	// ProduceMessage produce the message with its headers, timestamp and, with
+	// the ManualPartitioner, partition. It returns ctx.Err() if ctx is done
+	// before the message is acknowledged, the message may still be delivered.
+	// A message without Value and RawValue is sent as a tombstone. It returns
+	// -1, -1 on errors.
+	ProduceMessage(ctx context.Context, msg *Message) (partition int32, offset int64, err error)
+	// ProduceBatch produce the messages at once and sets their partitions and
+	// offsets. It returns a *BatchError with the indexes of the messages which
+	// could not be produced.
+	ProduceBatch(ctx context.Context, msgs []*Message) error
+	// ProduceRaw produce the message as it is, without encoding the key and the value.
+	ProduceRaw(msg *sarama.ProducerMessage) (partition int32, offset int64, err error)
+	// Ready returns an error if the brokers are not reachable.
+	Ready(ctx context.Context) error
+	// Close closes the producer.
+	Close() error
 }
 
 type producer struct {
+	client   sarama.Client
 	syncProd sarama.SyncProducer
-	cfg      Config
+	cfg      ProducerConfig
+	metrics  *producerMetrics
 }
 
-// NewProducer creates a producer instance.
-func NewProducer(cfg Config) Producer {
-	config := sarama.NewConfig()
-	config.Version = sarama.V2_0_1_0
-	config.Producer.Partitioner = sarama.NewHashPartitioner
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Return.Successes = true
-	config.Producer.Compression = sarama.CompressionNone
-	config.Producer.MaxMessageBytes = 10000000
-	config.Producer.Retry.Max = 10
-	config.Producer.Retry.Backoff = 1000 * time.Millisecond
-	p, err := sarama.NewSyncProducer(cfg.Brokers, config)
+// NewProducer creates a producer instance. It returns ValidationErrors if the
+// configurations are invalid.
+func NewProducer(cfg ProducerConfig) (Producer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the producer client: %w", err)
+	}
+	p, err := sarama.NewSyncProducerFromClient(client)
 	if err != nil {
-		cfg.Logger.WithError(err).Fatalf("Unable to create producer.")
+		_ = client.Close()
+		return nil, fmt.Errorf("unable to create the producer: %w", err)
 	}
 	return &producer{
+		client:   client,
 		syncProd: p,
 		cfg:      cfg,
-	}
+		metrics:  newProducerMetrics(cfg.Metrics),
+	}, nil
 }
 
-// Produce produce the kafka message to the given topic.
+// Produce produce the kafka message to the given topic. A nil value is sent as
+// a tombstone.
 func (p *producer) Produce(topic string, schema string, key interface{}, value interface{}) (partition int32, offset int64, err error) {
-	keyStr, ok := value.(string)
-	if !ok {
-		err = fmt.Errorf("key should be string. got: %s", value)
-		p.cfg.Logger.WithError(err).Errorf("Invalid key")
-		return
-	}
-	valueEncoder := p.cfg.EncoderBuilder.Build(schema, value)
-	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Key:   sarama.StringEncoder(keyStr),
-		Value: valueEncoder,
-	}
-	return p.syncProd.SendMessage(msg)
+	return p.ProduceMessage(context.Background(), &Message{Topic: topic, Schema: schema, Key: key, Value: value})
+}
+
+// ProduceMessage produce the message with its headers, timestamp and partition.
+func (p *producer) ProduceMessage(ctx context.Context, msg *Message) (partition int32, offset int64, err error) {
+	pm, err := p.cfg.producerMessage(msg)
+	if err != nil {
+		return -1, -1, err
+	}
+	err = wait(ctx, func() error {
+		_, _, err := p.ProduceRaw(pm)
+		return err
+	})
+	if err != nil {
+		return -1, -1, err
+	}
+	msg.Partition, msg.Offset = pm.Partition, pm.Offset
+	return pm.Partition, pm.Offset, nil
+}
+
+// ProduceBatch produce the messages at once and sets their partitions and offsets.
+func (p *producer) ProduceBatch(ctx context.Context, msgs []*Message) error {
+	pms := make([]*sarama.ProducerMessage, 0, len(msgs))
+	indexes := make(map[*sarama.ProducerMessage]int, len(msgs))
+	for i, msg := range msgs {
+		pm, err := p.cfg.producerMessage(msg)
+		if err != nil {
+			return fmt.Errorf("unable to encode the message %d: %w", i, err)
+		}
+		pms = append(pms, pm)
+		indexes[pm] = i
+	}
+	err := wait(ctx, func() error {
+		start := time.Now()
+		err := p.syncProd.SendMessages(pms)
+		for _, pm := range pms {
+			p.metrics.sendDuration.Observe(time.Since(start).Seconds(), pm.Topic)
+		}
+		return err
+	})
+	var perrs sarama.ProducerErrors
+	if err != nil && !errors.As(err, &perrs) {
+		return err
+	}
+	batchErr := NewBatchError()
+	for _, perr := range perrs {
+		p.metrics.sendFailures.Inc(perr.Msg.Topic)
+		batchErr.Add(indexes[perr.Msg], perr.Err)
+	}
+	for i, pm := range pms {
+		if _, failed := batchErr.Errors[i]; !failed {
+			msgs[i].Partition, msgs[i].Offset = pm.Partition, pm.Offset
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// producerMessage encodes the message. The raw key and value are sent as they
+// are if set.
+func (c *ProducerConfig) producerMessage(msg *Message) (*sarama.ProducerMessage, error) {
+	pm := &sarama.ProducerMessage{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Timestamp: msg.Timestamp,
+	}
+	for _, h := range msg.Headers {
+		if h != nil {
+			pm.Headers = append(pm.Headers, *h)
+		}
+	}
+	if msg.RawKey != nil {
+		pm.Key = sarama.ByteEncoder(msg.RawKey)
+	} else {
+		key, err := c.KeyEncoder(msg.Key)
+		if err != nil {
+			c.Logger.WithError(err).Errorf("Invalid key")
+			return nil, err
+		}
+		pm.Key = key
+	}
+	switch {
+	case msg.RawValue != nil:
+		pm.Value = sarama.ByteEncoder(msg.RawValue)
+	case msg.Value != nil:
+		pm.Value = c.EncoderBuilder.Build(msg.Schema, msg.Value)
+	}
+	return pm, nil
+}
+
+// wait runs send and returns its error, or ctx.Err() if ctx is done first.
+func wait(ctx context.Context, send func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- send()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ProduceRaw produce the message as it is, without encoding the key and the value.
+func (p *producer) ProduceRaw(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	start := time.Now()
+	partition, offset, err = p.syncProd.SendMessage(msg)
+	p.metrics.sendDuration.Observe(time.Since(start).Seconds(), msg.Topic)
+	if err != nil {
+		p.metrics.sendFailures.Inc(msg.Topic)
+	}
+	return
+}
+
+// Ready returns an error if the controller broker can not be reached.
+func (p *producer) Ready(ctx context.Context) error {
+	return clientReady(ctx, p.client)
 }
 
-func (ap *producer) Close() {
-	ap.syncProd.Close()
+// clientReady returns an error if the controller broker can not be reached.
+func clientReady(ctx context.Context, client sarama.Client) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.RefreshController()
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("brokers are not reachable: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the producer and its client.
+func (p *producer) Close() error {
+	err := p.syncProd.Close()
+	if p.client == nil {
+		return err
+	}
+	if cerr := p.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
@@ -0,0 +1,206 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Acks acknowledgements required from the brokers for a produced message.
+type Acks string
+
+// Compression compression codec of the produced messages.
+type Compression string
+
+// Partitioner strategy choosing the partition of the produced messages.
+type Partitioner string
+
+const (
+	Version_2_0_1 Version = "2.0.1"
+
+	AcksNone   Acks = "none"
+	AcksLeader Acks = "leader"
+	AcksAll    Acks = "all"
+
+	CompressionNone   Compression = "none"
+	CompressionGzip   Compression = "gzip"
+	CompressionSnappy Compression = "snappy"
+	CompressionLZ4    Compression = "lz4"
+	CompressionZstd   Compression = "zstd"
+
+	HashPartitioner       Partitioner = "hash"
+	RandomPartitioner     Partitioner = "random"
+	RoundRobinPartitioner Partitioner = "roundrobin"
+	ManualPartitioner     Partitioner = "manual"
+
+	defaultProducerRetryMax     = 10
+	defaultProducerRetryBackoff = time.Second
+	defaultMaxMessageBytes      = 10000000
+)
+
+// ProducerConfig configurations of the producers.
+type ProducerConfig struct {
+	ClientConfig
+	// EncoderBuilder builds the encoders of the values given to Produce.
+	// DefaultEncoderBuilder is used if not set.
+	EncoderBuilder EncoderBuilder
+	// KeyEncoder encodes the keys given to Produce. DefaultKeyEncoder is used
+	// if not set.
+	KeyEncoder KeyEncoder
+	// Acks defaults to AcksAll.
+	Acks Acks
+	// Compression defaults to CompressionNone.
+	Compression Compression
+	// Idempotent enables the idempotent producer, which does not write
+	// duplicates when retrying. It requires AcksAll.
+	Idempotent bool
+	// RetryMax and RetryBackoff number of retries of a failed produce and the
+	// delay between them. Defaults to 10 retries, 1s apart. Set RetryMax to a
+	// negative value to disable the retries.
+	RetryMax     int
+	RetryBackoff time.Duration
+	// MaxMessageBytes maximum size of a message. Defaults to 10MB.
+	MaxMessageBytes int
+	// Partitioner defaults to HashPartitioner.
+	Partitioner Partitioner
+	// Linger time the messages are buffered to be sent in batches. A batch is
+	// sent earlier when it reaches BatchMessages messages or BatchBytes bytes,
+	// and never has more than MaxBatchMessages messages. Messages are sent
+	// as soon as possible if none is set.
+	Linger           time.Duration
+	BatchMessages    int
+	BatchBytes       int
+	MaxBatchMessages int
+	// ReturnReports sends the deliveries of the messages sent by an
+	// AsyncProducer without callback to AsyncProducer.Reports.
+	ReturnReports bool
+	// TransactionalID identifies the transactional producer across restarts.
+	// In a TransactionalPolicy it is the prefix of the ids of the partitions.
+	// It enables the idempotent producer.
+	TransactionalID string
+}
+
+// validate verifies the producer configurations and sets default values.
+// It returns ValidationErrors with all the invalid fields.
+func (c *ProducerConfig) validate() error {
+	errs := c.ClientConfig.validate()
+	if c.Version == "" {
+		c.Version = Version_2_0_1
+	}
+	if c.EncoderBuilder == nil {
+		c.EncoderBuilder = DefaultEncoderBuilder()
+	}
+	if c.KeyEncoder == nil {
+		c.KeyEncoder = DefaultKeyEncoder()
+	}
+	switch c.Acks {
+	case "":
+		c.Acks = AcksAll
+	case AcksNone, AcksLeader, AcksAll:
+	default:
+		errs.add("Acks", "unknown acks %q", c.Acks)
+	}
+	switch c.Compression {
+	case "":
+		c.Compression = CompressionNone
+	case CompressionNone, CompressionGzip, CompressionSnappy, CompressionLZ4, CompressionZstd:
+	default:
+		errs.add("Compression", "unknown compression %q", c.Compression)
+	}
+	switch c.Partitioner {
+	case "":
+		c.Partitioner = HashPartitioner
+	case HashPartitioner, RandomPartitioner, RoundRobinPartitioner, ManualPartitioner:
+	default:
+		errs.add("Partitioner", "unknown partitioner %q", c.Partitioner)
+	}
+	if c.TransactionalID != "" {
+		c.Idempotent = true
+	}
+	if c.Idempotent && c.Acks != AcksAll {
+		errs.add("Acks", "the idempotent producer requires %q acks", AcksAll)
+	}
+	if c.RetryMax == 0 {
+		c.RetryMax = defaultProducerRetryMax
+	}
+	if c.Idempotent && c.RetryMax < 0 {
+		errs.add("RetryMax", "the idempotent producer requires retries")
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultProducerRetryBackoff
+	}
+	if c.MaxMessageBytes <= 0 {
+		c.MaxMessageBytes = defaultMaxMessageBytes
+	}
+	if c.Linger < 0 {
+		errs.add("Linger", "linger can not be negative")
+	}
+	if c.BatchMessages < 0 || c.BatchBytes < 0 || c.MaxBatchMessages < 0 {
+		errs.add("BatchMessages", "batch sizes can not be negative")
+	}
+	if c.MaxBatchMessages > 0 && c.BatchMessages > c.MaxBatchMessages {
+		errs.add("BatchMessages", "must not exceed MaxBatchMessages")
+	}
+	return errs.err()
+}
+
+// saramaConfig creates the sarama configurations of the producer.
+func (c *ProducerConfig) saramaConfig() (*sarama.Config, error) {
+	config, err := c.ClientConfig.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch c.Acks {
+	case AcksNone:
+		config.Producer.RequiredAcks = sarama.NoResponse
+	case AcksLeader:
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	default:
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	}
+	switch c.Compression {
+	case CompressionGzip:
+		config.Producer.Compression = sarama.CompressionGZIP
+	case CompressionSnappy:
+		config.Producer.Compression = sarama.CompressionSnappy
+	case CompressionLZ4:
+		config.Producer.Compression = sarama.CompressionLZ4
+	case CompressionZstd:
+		config.Producer.Compression = sarama.CompressionZSTD
+	default:
+		config.Producer.Compression = sarama.CompressionNone
+	}
+	switch c.Partitioner {
+	case RandomPartitioner:
+		config.Producer.Partitioner = sarama.NewRandomPartitioner
+	case RoundRobinPartitioner:
+		config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	case ManualPartitioner:
+		config.Producer.Partitioner = sarama.NewManualPartitioner
+	default:
+		config.Producer.Partitioner = sarama.NewHashPartitioner
+	}
+	if c.Idempotent {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+	config.Producer.Transaction.ID = c.TransactionalID
+	config.Producer.Retry.Max = c.RetryMax
+	if c.RetryMax < 0 {
+		config.Producer.Retry.Max = 0
+	}
+	config.Producer.Retry.Backoff = c.RetryBackoff
+	config.Producer.MaxMessageBytes = c.MaxMessageBytes
+	config.Producer.Flush.Frequency = c.Linger
+	config.Producer.Flush.Messages = c.BatchMessages
+	config.Producer.Flush.Bytes = c.BatchBytes
+	config.Producer.Flush.MaxMessages = c.MaxBatchMessages
+	config.Producer.Return.Successes = true
+	return config, nil
+}
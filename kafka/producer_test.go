@@ -5,3 +5,153 @@
 
 // Package kafka
 package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+func newTestProducer(t *testing.T, syncProd func(config *sarama.Config) sarama.SyncProducer) *producer {
+	cfg := ProducerConfig{ClientConfig: ClientConfig{Brokers: []string{"localhost:9092"}, Metrics: metrics.NewRegistry()}}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	return &producer{syncProd: syncProd(config), cfg: cfg, metrics: newProducerMetrics(cfg.Metrics)}
+}
+
+// expectMessage checks the encoded key and value of the produced message.
+func expectMessage(key, value string) mocks.MessageChecker {
+	return func(pm *sarama.ProducerMessage) error {
+		k, _ := pm.Key.Encode()
+		v, _ := pm.Value.Encode()
+		if string(k) != key || string(v) != value {
+			return fmt.Errorf("expected key %s and value %s, got %s and %s", key, value, k, v)
+		}
+		return nil
+	}
+}
+
+func TestProducer_Produce(t *testing.T) {
+	var mock *mocks.SyncProducer
+	p := newTestProducer(t, func(config *sarama.Config) sarama.SyncProducer {
+		mock = mocks.NewSyncProducer(t, config)
+		return mock
+	})
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectMessage("o-1", `{"id":"o-1","amount":10.5}`))
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectMessage("42", `"created"`))
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+		if pm.Value != nil {
+			return fmt.Errorf("expected a tombstone, got %v", pm.Value)
+		}
+		return nil
+	})
+
+	// Values of any type are encoded, the key is encoded by the KeyEncoder.
+	if _, _, err := p.Produce("orders", "orders-value", "o-1", order{ID: "o-1", Amount: 10.5}); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+	if _, _, err := p.Produce("orders", "orders-value", 42, "created"); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+	// A nil value is sent as a tombstone.
+	if _, _, err := p.Produce("orders", "orders-value", "o-1", nil); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+}
+
+func TestProducer_ProduceMessage(t *testing.T) {
+	var mock *mocks.SyncProducer
+	p := newTestProducer(t, func(config *sarama.Config) sarama.SyncProducer {
+		mock = mocks.NewSyncProducer(t, config)
+		return mock
+	})
+	timestamp := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+		if !pm.Timestamp.Equal(timestamp) || len(pm.Headers) != 1 || string(pm.Headers[0].Key) != "x-trace-id" {
+			return fmt.Errorf("unexpected message %+v", pm)
+		}
+		return expectMessage("o-1", "raw")(pm)
+	})
+
+	msg := &Message{
+		Topic:     "orders",
+		Timestamp: timestamp,
+		Headers:   []*sarama.RecordHeader{{Key: []byte("x-trace-id"), Value: []byte("t-1")}},
+		Key:       "o-1",
+		RawValue:  []byte("raw"),
+	}
+	_, offset, err := p.ProduceMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if offset != 1 || msg.Offset != 1 {
+		t.Errorf("Expected offset 1, got %d and %d", offset, msg.Offset)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	partition, offset, err := p.ProduceMessage(ctx, msg)
+	if !errors.Is(err, context.Canceled) || partition != -1 || offset != -1 {
+		t.Errorf("Expected context.Canceled with -1, -1, got %v, %d and %d", err, partition, offset)
+	}
+	if err = p.Close(); err != nil {
+		t.Errorf("Found error %s", err)
+	}
+}
+
+// failingSyncProducer fails the messages of the given topic.
+type failingSyncProducer struct {
+	sarama.SyncProducer
+	topic string
+}
+
+func (f *failingSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for i, msg := range msgs {
+		if msg.Topic == f.topic {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: sarama.ErrNotLeaderForPartition})
+			continue
+		}
+		msg.Offset = int64(i + 10)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func TestProducer_ProduceBatch(t *testing.T) {
+	p := newTestProducer(t, func(*sarama.Config) sarama.SyncProducer {
+		return &failingSyncProducer{topic: "payments"}
+	})
+	msgs := []*Message{
+		{Topic: "orders", Key: "o-1", Value: "a"},
+		{Topic: "payments", Key: "p-1", Value: "b"},
+		{Topic: "orders", Key: "o-2", Value: "c"},
+	}
+	err := p.ProduceBatch(context.Background(), msgs)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a batch error, got %v", err)
+	}
+	if len(batchErr.Errors) != 1 || !errors.Is(batchErr.Errors[1], sarama.ErrNotLeaderForPartition) {
+		t.Errorf("Expected message 1 to fail, got %v", batchErr.Errors)
+	}
+	if msgs[0].Offset != 10 || msgs[2].Offset != 12 {
+		t.Errorf("Expected the offsets of the produced messages, got %d and %d", msgs[0].Offset, msgs[2].Offset)
+	}
+}
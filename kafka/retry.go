@@ -0,0 +1,183 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// HeaderDueTime time, in unix milliseconds, the retried message is consumed after.
+const HeaderDueTime = "x-sterna-due-time"
+
+const retryTopicInfix = ".retry."
+
+// RetryPolicy republishes the failed messages to retry topics, one per delay
+// tier, instead of blocking the partition. The same consumer group consumes
+// the retry topics and calls the handler again once the delay has elapsed.
+// The retry topics must exist, ConsumerGroup.Run fails otherwise. The handler
+// receives the retried messages with the source topic in Message.Topic and
+// the retry topic in Message.ConsumedTopic.
+// Messages failing the last attempt are dead-lettered if a DeadLetterPolicy
+// is configured, otherwise ConsumerErrorHandler decides whether they are
+// committed.
+type RetryPolicy struct {
+	// Delays delay of each retry tier, e.g. 5s, 1m and 10m. The last tier is
+	// reused when MaxAttempts exceeds the number of tiers.
+	Delays []time.Duration
+	// MaxAttempts maximum number of times the handler is called with a
+	// message, including the first attempt. Defaults to len(Delays) + 1.
+	MaxAttempts int
+	// Producer producer used to republish the messages.
+	Producer Producer
+}
+
+// RetryTopic returns the retry topic of the given topic for the delay, e.g.
+// "orders.retry.5s" or "orders.retry.1m".
+func RetryTopic(topic string, delay time.Duration) string {
+	return topic + retryTopicInfix + formatDelay(delay)
+}
+
+// formatDelay formats the delay in its largest whole unit.
+func formatDelay(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+// topics returns the retry topics of the given topics.
+func (r *RetryPolicy) topics(topics []string) []string {
+	var retryTopics []string
+	seen := make(map[string]bool)
+	for _, topic := range topics {
+		for _, delay := range r.Delays {
+			if t := RetryTopic(topic, delay); !seen[t] {
+				seen[t] = true
+				retryTopics = append(retryTopics, t)
+			}
+		}
+	}
+	return retryTopics
+}
+
+// source returns the source topic of a message consumed from one of the
+// retry topics.
+func (r *RetryPolicy) source(msg *Message) (string, bool) {
+	source, ok := msg.Header(HeaderSourceTopic)
+	if !ok {
+		return "", false
+	}
+	for _, delay := range r.Delays {
+		if RetryTopic(string(source), delay) == msg.ConsumedTopic {
+			return string(source), true
+		}
+	}
+	return "", false
+}
+
+// missingTopics returns the given topics which do not exist in the cluster.
+func missingTopics(cfg ClientConfig, topics []string) ([]string, error) {
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the client: %w", err)
+	}
+	defer client.Close()
+	existing, err := client.Topics()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the topics: %w", err)
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, topic := range existing {
+		exists[topic] = true
+	}
+	var missing []string
+	for _, topic := range topics {
+		if !exists[topic] {
+			missing = append(missing, topic)
+		}
+	}
+	return missing, nil
+}
+
+// delay returns the delay before the next attempt of the message, or false if
+// no attempts are left.
+func (r *RetryPolicy) delay(msg *Message) (time.Duration, bool) {
+	failed := attempts(msg) + 1
+	if failed >= r.MaxAttempts || len(r.Delays) == 0 {
+		return 0, false
+	}
+	tier := failed - 1
+	if tier >= len(r.Delays) {
+		tier = len(r.Delays) - 1
+	}
+	return r.Delays[tier], true
+}
+
+// publish republishes the message to the retry topic of the delay.
+func (r *RetryPolicy) publish(msg *Message, delay time.Duration, cause error) error {
+	pm := republished(msg, RetryTopic(sourceTopic(msg), delay), cause)
+	due := time.Now().Add(delay).UnixNano() / int64(time.Millisecond)
+	pm.Headers = append(pm.Headers, header(HeaderDueTime, strconv.FormatInt(due, 10)))
+	_, _, err := r.Producer.ProduceRaw(pm)
+	return err
+}
+
+// dueTime returns the time the retried message should be consumed after.
+func dueTime(cm *sarama.ConsumerMessage) (time.Time, bool) {
+	for _, h := range cm.Headers {
+		if h == nil || string(h.Key) != HeaderDueTime {
+			continue
+		}
+		ms, err := strconv.ParseInt(string(h.Value), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)), true
+	}
+	return time.Time{}, false
+}
+
+// waitUntilDue pauses the partition until the retried message is due. It
+// returns false if the session ended before.
+func (c *ConsumerGroupHandler) waitUntilDue(ctx context.Context, cm *sarama.ConsumerMessage) bool {
+	due, ok := dueTime(cm)
+	if !ok {
+		return true
+	}
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+	c.cfg.Logger.Debugf("Delaying the message until it is due: topic = %s, partition = %d, offset = %d, due = %v", cm.Topic, cm.Partition, cm.Offset, due)
+	if c.listener != nil {
+		c.listener.delayStarted(cm.Topic, cm.Partition)
+		defer c.listener.delayEnded(cm.Topic, cm.Partition)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// consumed converts the produced message to the consumed one, marking it due.
+func consumed(pm *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	cm := &sarama.ConsumerMessage{Topic: pm.Topic}
+	cm.Value, _ = pm.Value.Encode()
+	if pm.Key != nil {
+		cm.Key, _ = pm.Key.Encode()
+	}
+	for i := range pm.Headers {
+		h := pm.Headers[i]
+		if string(h.Key) == HeaderDueTime {
+			h.Value = []byte(strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+		}
+		cm.Headers = append(cm.Headers, &h)
+	}
+	return cm
+}
+
+func TestRetryTopic(t *testing.T) {
+	for delay, expected := range map[time.Duration]string{
+		5 * time.Second:        "orders.retry.5s",
+		time.Minute:            "orders.retry.1m",
+		2 * time.Hour:          "orders.retry.2h",
+		90 * time.Second:       "orders.retry.90s",
+		250 * time.Millisecond: "orders.retry.250ms",
+	} {
+		if topic := RetryTopic("orders", delay); topic != expected {
+			t.Errorf("Expected %s, got %s", expected, topic)
+		}
+	}
+}
+
+func TestConsumerGroupHandler_Retry(t *testing.T) {
+	producer := &mockProducer{}
+	var attempts int
+	var handled []string
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Handler = func(ctx context.Context, msg *Message) error {
+		attempts++
+		handled = append(handled, msg.Topic+" "+msg.ConsumedTopic)
+		return errors.New("downstream unavailable")
+	}
+	cfg.Retry = &RetryPolicy{Delays: []time.Duration{5 * time.Second, time.Minute}, Producer: producer}
+	cfg.DeadLetter = &DeadLetterPolicy{Producer: producer}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	handler := getConsumerGroupHandler(cfg)
+
+	message := &sarama.ConsumerMessage{Topic: "orders", Value: []byte("a")}
+	for i := 0; i < 3; i++ {
+		claim := &mockClaim{topic: message.Topic, messages: make(chan *sarama.ConsumerMessage, 1)}
+		claim.messages <- message
+		close(claim.messages)
+		if err := handler.ConsumeClaim(newMockSession(), claim); err != nil {
+			t.Fatalf("Found error %s", err)
+		}
+		message = consumed(producer.messages[i])
+	}
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	// The retried messages have the source topic and the retry topic they were consumed from.
+	expectedHandled := []string{"orders orders", "orders orders.retry.5s", "orders orders.retry.1m"}
+	if !reflect.DeepEqual(handled, expectedHandled) {
+		t.Errorf("Expected handled topics %v, got %v", expectedHandled, handled)
+	}
+	var topics, attemptHeaders []string
+	for _, pm := range producer.messages {
+		topics = append(topics, pm.Topic)
+		for _, h := range pm.Headers {
+			if string(h.Key) == HeaderAttempt {
+				attemptHeaders = append(attemptHeaders, string(h.Value))
+			}
+		}
+	}
+	expected := []string{"orders.retry.5s", "orders.retry.1m", "orders.dlq"}
+	if !reflect.DeepEqual(topics, expected) {
+		t.Errorf("Expected topics %v, got %v", expected, topics)
+	}
+	if !reflect.DeepEqual(attemptHeaders, []string{"1", "2", "3"}) {
+		t.Errorf("Expected attempts [1 2 3], got %v", attemptHeaders)
+	}
+}
+
+func TestConsumerGroupHandler_RetryDelay(t *testing.T) {
+	client := &mockClient{}
+	cg := newTestConsumerGroup(client)
+	cg.cfg.Retry = &RetryPolicy{Delays: []time.Duration{time.Minute}, MaxAttempts: 2, Producer: &mockProducer{}}
+	if !reflect.DeepEqual(cg.topics(), []string{"orders", "payments", "orders.retry.1m", "payments.retry.1m"}) {
+		t.Errorf("Unexpected topics %v", cg.topics())
+	}
+
+	var handled time.Time
+	cg.cfg.Handler = func(ctx context.Context, msg *Message) error {
+		handled = time.Now()
+		return nil
+	}
+	handler := getConsumerGroupHandler(cg.cfg)
+	handler.listener = cg
+	due := time.Now().Add(50 * time.Millisecond)
+	claim := &mockClaim{topic: "orders.retry.1m", messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{
+		Topic:   "orders.retry.1m",
+		Value:   []byte("a"),
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderDueTime), Value: []byte(strconv.FormatInt(due.UnixNano()/int64(time.Millisecond), 10))}},
+	}
+	close(claim.messages)
+	session := newMockSession()
+	session.claims = map[string][]int32{"orders.retry.1m": {0}}
+	cg.sessionStarted(session)
+	if err := handler.ConsumeClaim(session, claim); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	if handled.Before(due.Truncate(time.Millisecond)) {
+		t.Errorf("Expected the message to be handled after %v, got %v", due, handled)
+	}
+	partitions := []map[string][]int32{{"orders.retry.1m": {0}}}
+	if !reflect.DeepEqual(client.paused, partitions) || !reflect.DeepEqual(client.resumed, partitions) {
+		t.Errorf("Expected the partition to be paused and resumed, got %v and %v", client.paused, client.resumed)
+	}
+	if !reflect.DeepEqual(session.markedOffsets(), []int64{1}) {
+		t.Errorf("Expected offset 1 to be committed, got %v", session.markedOffsets())
+	}
+}
+
+func TestRetryPolicy_InvalidDelays(t *testing.T) {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	cfg.Retry = &RetryPolicy{Delays: []time.Duration{5 * time.Second, 0}, Producer: &mockProducer{}}
+	var errs ValidationErrors
+	if err := cfg.validate(); !errors.As(err, &errs) || !errs.Has("Retry.Delays") {
+		t.Errorf("Expected an error of Retry.Delays, got %v", err)
+	}
+}
+
+func TestConsumerGroup_MissingRetryTopics(t *testing.T) {
+	cg := newTestConsumerGroup(&mockClient{})
+	cg.cfg.Retry = &RetryPolicy{Delays: []time.Duration{time.Minute}, Producer: &mockProducer{}}
+	var checked []string
+	cg.missingTopics = func(cfg ClientConfig, topics []string) ([]string, error) {
+		checked = topics
+		return topics[1:], nil
+	}
+	if err := cg.Init(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	err := cg.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "payments.retry.1m") {
+		t.Errorf("Expected the missing retry topic error, got %v", err)
+	}
+	if !reflect.DeepEqual(checked, []string{"orders.retry.1m", "payments.retry.1m"}) {
+		t.Errorf("Expected the retry topics to be checked, got %v", checked)
+	}
+}
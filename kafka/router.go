@@ -0,0 +1,235 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/udayangaac/sterna/kafka/avro"
+)
+
+// ErrNoRoute returned by the router for the messages matching no route when
+// there is no fallback handler.
+var ErrNoRoute = errors.New("no route for the message")
+
+// EventTypeFunc extracts the event type of a message from its headers or
+// raw bytes.
+type EventTypeFunc func(msg *Message) (eventType string, err error)
+
+// Route handler of the messages matching the topic, the topic pattern and the
+// event type. Empty fields match any message.
+type Route struct {
+	Topic        string
+	TopicPattern *regexp.Regexp
+	EventType    string
+	// Decoder decodes the messages of the route. The decoder of the router is
+	// used if not set.
+	Decoder Decoder
+	Handler Handler
+}
+
+// matches reports whether the route matches the message.
+func (r *Route) matches(topic, eventType string) bool {
+	if r.Topic != "" && r.Topic != topic {
+		return false
+	}
+	if r.TopicPattern != nil && !r.TopicPattern.MatchString(topic) {
+		return false
+	}
+	return r.EventType == "" || r.EventType == eventType
+}
+
+// Router dispatches the messages of a consumer group to the handler of the
+// first matching route, in registration order. Set the router with
+// Router.Apply, which configures both the decoder and the handler.
+type Router struct {
+	routes    []Route
+	decoder   Decoder
+	eventType EventTypeFunc
+	fallback  Handler
+}
+
+// NewRouter creates a router decoding the messages with the given decoder
+// unless the route has its own one. GetDefaultDecoder is used if decoder is nil.
+func NewRouter(decoder Decoder) *Router {
+	if decoder == nil {
+		decoder = GetDefaultDecoder()
+	}
+	return &Router{decoder: decoder}
+}
+
+// Route adds a route.
+func (r *Router) Route(route Route) *Router {
+	r.routes = append(r.routes, route)
+	return r
+}
+
+// Topic routes the messages of the topic to the handler.
+func (r *Router) Topic(topic string, handler Handler) *Router {
+	return r.Route(Route{Topic: topic, Handler: handler})
+}
+
+// TopicPattern routes the messages of the topics matching the pattern to the handler.
+func (r *Router) TopicPattern(pattern *regexp.Regexp, handler Handler) *Router {
+	return r.Route(Route{TopicPattern: pattern, Handler: handler})
+}
+
+// EventType routes the messages of the event type to the handler. The event
+// type is extracted with the function set by EventTypeFrom.
+func (r *Router) EventType(eventType string, handler Handler) *Router {
+	return r.Route(Route{EventType: eventType, Handler: handler})
+}
+
+// EventTypeFrom sets the function extracting the event type of the messages.
+func (r *Router) EventTypeFrom(fn EventTypeFunc) *Router {
+	r.eventType = fn
+	return r
+}
+
+// Fallback sets the handler of the messages matching no route.
+func (r *Router) Fallback(handler Handler) *Router {
+	r.fallback = handler
+	return r
+}
+
+// routing route resolved for a message, kept on the message so that the event
+// type is extracted once.
+type routing struct {
+	route *Route
+	err   error
+}
+
+// Apply sets the decoder and the handler of the configuration to the router.
+// The route of each message is resolved once, while it is decoded.
+func (r *Router) Apply(cfg *ConsumerConfig) {
+	cfg.Decoder = r.Decoder()
+	cfg.decodeMessage = r.decode
+	cfg.Handler = r.Handle
+}
+
+// Decoder returns the decoder dispatching to the decoder of the matching route.
+func (r *Router) Decoder() Decoder {
+	return func(cm *sarama.ConsumerMessage) (key, value interface{}, err error) {
+		return r.decode(newMessage(cm))
+	}
+}
+
+// decode resolves the route of the message, keeps it on the message and
+// decodes the message with the decoder of the route.
+func (r *Router) decode(msg *Message) (key, value interface{}, err error) {
+	route, err := r.match(msg)
+	msg.route = &routing{route: route, err: err}
+	if err != nil || route == nil || route.Decoder == nil {
+		return r.decoder(msg.raw)
+	}
+	return route.Decoder(msg.raw)
+}
+
+// Handle calls the handler of the matching route, or the fallback handler.
+// The route resolved while decoding the message is reused.
+func (r *Router) Handle(ctx context.Context, msg *Message) error {
+	var route *Route
+	var err error
+	if msg.route != nil {
+		route, err = msg.route.route, msg.route.err
+	} else {
+		route, err = r.match(msg)
+	}
+	if err != nil {
+		return err
+	}
+	if route != nil {
+		return route.Handler(ctx, msg)
+	}
+	if r.fallback != nil {
+		return r.fallback(ctx, msg)
+	}
+	return fmt.Errorf("%w: topic = %s, partition = %d, offset = %d", ErrNoRoute, msg.ConsumedTopic, msg.Partition, msg.Offset)
+}
+
+// match returns the first route matching the message, or nil.
+func (r *Router) match(msg *Message) (*Route, error) {
+	var eventType string
+	if r.eventType != nil {
+		var err error
+		if eventType, err = r.eventType(msg); err != nil {
+			return nil, fmt.Errorf("unable to get the event type: %w", err)
+		}
+	}
+	topic := sourceTopic(msg)
+	for i := range r.routes {
+		if r.routes[i].matches(topic, eventType) {
+			return &r.routes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// EventTypeHeader extracts the event type from the header with the given key.
+func EventTypeHeader(key string) EventTypeFunc {
+	return func(msg *Message) (string, error) {
+		v, _ := msg.Header(key)
+		return string(v), nil
+	}
+}
+
+// EventTypeJSONField extracts the event type from a string field of the JSON
+// value. Nested fields are separated by dots, e.g. "metadata.type".
+func EventTypeJSONField(field string) EventTypeFunc {
+	path := strings.Split(field, ".")
+	return func(msg *Message) (string, error) {
+		var v interface{}
+		if err := json.Unmarshal(msg.RawValue, &v); err != nil {
+			return "", err
+		}
+		for _, key := range path {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return "", nil
+			}
+			v = obj[key]
+		}
+		eventType, _ := v.(string)
+		return eventType, nil
+	}
+}
+
+// EventTypeAvroRecord extracts the event type as the full name of the Avro
+// record, e.g. "com.example.OrderCreated", from the schema id of the value.
+func EventTypeAvroRecord(ss avro.SchemaStore) EventTypeFunc {
+	return func(msg *Message) (string, error) {
+		if len(msg.RawValue) < 5 {
+			return "", errors.New("value is not in the Avro wire format")
+		}
+		detail, err := ss.GetSchemaByID(int(binary.BigEndian.Uint32(msg.RawValue[1:5])))
+		if err != nil {
+			return "", err
+		}
+		schema := detail.Schema
+		if detail.Codec != nil {
+			schema = detail.Codec.Schema()
+		}
+		record := struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		}{}
+		if err = json.Unmarshal([]byte(schema), &record); err != nil {
+			return "", err
+		}
+		if record.Namespace == "" || strings.Contains(record.Name, ".") {
+			return record.Name, nil
+		}
+		return record.Namespace + "." + record.Name, nil
+	}
+}
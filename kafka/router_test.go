@@ -0,0 +1,133 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/linkedin/goavro/v2"
+	"github.com/udayangaac/sterna/kafka/avro"
+)
+
+type mockSchemaStore map[int]avro.SchemaDetail
+
+func (m mockSchemaStore) GetSchemaBySubject(subject string) (avro.SchemaDetail, error) {
+	return avro.SchemaDetail{}, errors.New("not supported")
+}
+
+func (m mockSchemaStore) GetSchemaByID(id int) (avro.SchemaDetail, error) {
+	detail, ok := m[id]
+	if !ok {
+		return detail, errors.New("schema not found")
+	}
+	return detail, nil
+}
+
+// route records the messages routed to the handler with the given name.
+func route(name string, routed *string) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		*routed = name + ":" + msg.Value.(string)
+		return nil
+	}
+}
+
+func routeMessage(t *testing.T, router *Router, cm *sarama.ConsumerMessage) error {
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	router.Apply(&cfg)
+	msg, err := getConsumerGroupHandler(cfg).decode(cm, nil)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	return cfg.Handler(context.Background(), msg)
+}
+
+func TestRouter_EventTypeOnce(t *testing.T) {
+	var routed string
+	calls := 0
+	router := NewRouter(nil).
+		EventTypeFrom(func(msg *Message) (string, error) {
+			calls++
+			return "OrderCreated", nil
+		}).
+		EventType("OrderCreated", route("created", &routed))
+	if err := routeMessage(t, router, &sarama.ConsumerMessage{Topic: "orders", Value: []byte("a")}); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if routed != "created:a" || calls != 1 {
+		t.Errorf("Expected the event type to be extracted once, got %d calls and %q", calls, routed)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var routed string
+	upper := func(cm *sarama.ConsumerMessage) (interface{}, interface{}, error) {
+		return string(cm.Key), "upper " + string(cm.Value), nil
+	}
+	router := NewRouter(nil).
+		EventTypeFrom(EventTypeHeader("event-type")).
+		Route(Route{Topic: "orders", EventType: "OrderCreated", Handler: route("created", &routed)}).
+		Topic("orders", route("orders", &routed)).
+		Route(Route{TopicPattern: regexp.MustCompile(`^audit\.`), Decoder: upper, Handler: route("audit", &routed)}).
+		EventType("Ping", route("ping", &routed))
+
+	for _, tc := range []struct {
+		message  *sarama.ConsumerMessage
+		expected string
+	}{
+		{&sarama.ConsumerMessage{Topic: "orders", Value: []byte("a"), Headers: []*sarama.RecordHeader{{Key: []byte("event-type"), Value: []byte("OrderCreated")}}}, "created:a"},
+		{&sarama.ConsumerMessage{Topic: "orders", Value: []byte("b")}, "orders:b"},
+		{&sarama.ConsumerMessage{Topic: "audit.users", Value: []byte("c")}, "audit:upper c"},
+		{&sarama.ConsumerMessage{Topic: "payments", Value: []byte("d"), Headers: []*sarama.RecordHeader{{Key: []byte("event-type"), Value: []byte("Ping")}}}, "ping:d"},
+		// Retried messages are routed by their source topic.
+		{&sarama.ConsumerMessage{Topic: "orders.retry.5s", Value: []byte("e"), Headers: []*sarama.RecordHeader{{Key: []byte(HeaderSourceTopic), Value: []byte("orders")}}}, "orders:e"},
+	} {
+		routed = ""
+		if err := routeMessage(t, router, tc.message); err != nil {
+			t.Fatalf("Found error %s", err)
+		}
+		if routed != tc.expected {
+			t.Errorf("Expected %s, got %s", tc.expected, routed)
+		}
+	}
+
+	if err := routeMessage(t, router, &sarama.ConsumerMessage{Topic: "payments", Value: []byte("f")}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("Expected ErrNoRoute, got %v", err)
+	}
+	router.Fallback(route("fallback", &routed))
+	if err := routeMessage(t, router, &sarama.ConsumerMessage{Topic: "payments", Value: []byte("f")}); err != nil || routed != "fallback:f" {
+		t.Errorf("Expected the fallback handler, got %s, %v", routed, err)
+	}
+}
+
+func TestEventTypeJSONField(t *testing.T) {
+	eventType, err := EventTypeJSONField("metadata.type")(&Message{RawValue: []byte(`{"metadata": {"type": "OrderCreated"}}`)})
+	if err != nil || eventType != "OrderCreated" {
+		t.Errorf("Expected OrderCreated, got %s, %v", eventType, err)
+	}
+	if _, err = EventTypeJSONField("type")(&Message{RawValue: []byte(`not json`)}); err == nil {
+		t.Errorf("Expected an error for an invalid JSON value")
+	}
+}
+
+func TestEventTypeAvroRecord(t *testing.T) {
+	codec, err := goavro.NewCodec(`{"type": "record", "name": "OrderCreated", "namespace": "com.example", "fields": [{"name": "id", "type": "string"}]}`)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	fn := EventTypeAvroRecord(mockSchemaStore{7: {ID: 7, Codec: codec}})
+	eventType, err := fn(&Message{RawValue: []byte{0, 0, 0, 0, 7, 2, 'a'}})
+	if err != nil || eventType != "com.example.OrderCreated" {
+		t.Errorf("Expected com.example.OrderCreated, got %s, %v", eventType, err)
+	}
+	if _, err = fn(&Message{RawValue: []byte{0, 0, 0, 0, 8}}); err == nil {
+		t.Errorf("Expected an error for an unknown schema")
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// TransformHandler handles a consumed message and returns the messages to
+// produce in the same transaction. Returning an error aborts the transaction.
+type TransformHandler func(ctx context.Context, msg *Message) (outputs []*Message, err error)
+
+// TransactionalPolicy processes the consumed messages exactly once: the
+// outputs of Handler are produced and the offsets of the consumed messages are
+// committed in the same kafka transaction. The messages of an aborted
+// transaction are consumed again after the consumer group is rejoined, with
+// the rejoin backoff. If DeadLetter is set, the messages which could not be
+// decoded or handled are published to the dead-letter topic in the same
+// transaction and DeadLetter.Producer is not used.
+//
+// Each claimed partition has its own producer with the transactional id
+// "<Producer.TransactionalID>-<topic>-<partition>", so the producer of the
+// new owner of a partition fences the one of the previous owner after a
+// rebalance.
+//
+// Up to BatchSize already fetched messages of a partition are processed in a
+// transaction. Middlewares and Dedup are not applied to the Handler.
+type TransactionalPolicy struct {
+	// Producer configurations of the transactional producers.
+	// Producer.TransactionalID is the required prefix of the transactional
+	// ids and must be the same for all the instances of the application. The
+	// client configurations of the consumer group are used if Producer.Brokers
+	// is not set.
+	Producer ProducerConfig
+	Handler  TransformHandler
+}
+
+// validate verifies the policy and sets default values.
+func (t *TransactionalPolicy) validate(c *ConsumerConfig, errs *ValidationErrors) {
+	if t.Handler == nil {
+		errs.add("Transactional.Handler", "handler is required")
+	}
+	if t.Producer.TransactionalID == "" {
+		errs.add("Transactional.Producer.TransactionalID", "transactional id prefix is required")
+	}
+	if len(t.Producer.Brokers) == 0 {
+		t.Producer.ClientConfig = c.ClientConfig
+	}
+	if err := t.Producer.validate(); err != nil {
+		if producerErrs, ok := err.(ValidationErrors); ok {
+			for _, e := range producerErrs {
+				errs.add("Transactional.Producer."+e.Key, "%s", e.Message)
+			}
+		}
+	}
+	if c.BatchCallback != nil || c.Concurrency > 1 || c.Retry != nil {
+		errs.add("Transactional", "can not be used with BatchCallback, Concurrency or Retry")
+	}
+	if c.CommitMode != CommitAuto {
+		errs.add("CommitMode", "offsets are committed by the transactions")
+	}
+}
+
+// transactionalID returns the transactional id of the producer of a partition.
+func transactionalID(prefix, topic string, partition int32) string {
+	return fmt.Sprintf("%s-%s-%d", prefix, topic, partition)
+}
+
+// transaction transactional producer of a claimed partition.
+type transaction struct {
+	client   sarama.Client
+	producer sarama.AsyncProducer
+}
+
+func newTransaction(cfg ProducerConfig) (*transaction, error) {
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the transactional producer client: %w", err)
+	}
+	p, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("unable to create the transactional producer: %w", err)
+	}
+	return &transaction{client: client, producer: p}, nil
+}
+
+// produce sends the messages and waits until they are delivered. It returns
+// the first delivery error.
+func (t *transaction) produce(msgs []*sarama.ProducerMessage) (err error) {
+	for sent, delivered := 0, 0; delivered < len(msgs); {
+		// Results are read while sending so the producer never blocks.
+		var input chan<- *sarama.ProducerMessage
+		var next *sarama.ProducerMessage
+		if sent < len(msgs) {
+			input, next = t.producer.Input(), msgs[sent]
+		}
+		select {
+		case input <- next:
+			sent++
+		case _, ok := <-t.producer.Successes():
+			if !ok {
+				return ErrProducerClosed
+			}
+			delivered++
+		case perr, ok := <-t.producer.Errors():
+			if !ok {
+				return ErrProducerClosed
+			}
+			delivered++
+			if err == nil {
+				err = fmt.Errorf("unable to produce the message to %s: %w", perr.Msg.Topic, perr.Err)
+			}
+		}
+	}
+	return err
+}
+
+// close closes the producer and its client.
+func (t *transaction) close() error {
+	err := t.producer.Close()
+	if t.client == nil {
+		return err
+	}
+	if closeErr := t.client.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// consumeTransactionally processes the messages of the claim in transactions
+// of up to BatchSize messages with the producer of the partition. It does not
+// wait for more messages than the ones already fetched. It returns the error
+// of an aborted transaction, which ends the session so that the messages are
+// consumed again from the committed offsets.
+func (c *ConsumerGroupHandler) consumeTransactionally(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	cfg := c.cfg.Transactional.Producer
+	cfg.TransactionalID = transactionalID(cfg.TransactionalID, claim.Topic(), claim.Partition())
+	txn, err := c.newTransaction(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := txn.close(); closeErr != nil {
+			c.cfg.Logger.WithError(closeErr).Errorf("Unable to close the transactional producer %s", cfg.TransactionalID)
+		}
+	}()
+	batch := make([]*sarama.ConsumerMessage, 0, c.cfg.BatchSize)
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			batch = append(batch[:0], message)
+		collect:
+			for len(batch) < c.cfg.BatchSize {
+				select {
+				case message, ok := <-claim.Messages():
+					if !ok {
+						break collect
+					}
+					batch = append(batch, message)
+				default:
+					break collect
+				}
+			}
+			if err := c.processTransaction(session, txn, batch); err != nil {
+				return err
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// processTransaction processes the messages of the batch and commits their
+// offsets in a transaction. The transaction is aborted if any of them fails.
+func (c *ConsumerGroupHandler) processTransaction(session sarama.ConsumerGroupSession, txn *transaction, batch []*sarama.ConsumerMessage) error {
+	if err := txn.producer.BeginTxn(); err != nil {
+		return fmt.Errorf("unable to begin the transaction: %w", err)
+	}
+	deadLetters, err := c.transform(session, txn, batch)
+	if err == nil {
+		if err = txn.producer.CommitTxn(); err != nil {
+			err = fmt.Errorf("unable to commit the transaction: %w", err)
+		}
+	}
+	if err != nil {
+		return c.abort(txn, batch[0], err)
+	}
+	c.metrics.transactions.Inc(c.cfg.Group, txnCommitted)
+	for _, dl := range deadLetters {
+		c.cfg.Logger.WithError(dl.cause).Warnf("Message published to the dead-letter topic. topic = %s, partition = %d, offset = %d", dl.msg.ConsumedTopic, dl.msg.Partition, dl.msg.Offset)
+		c.metrics.errorDecisions.Inc(dl.msg.ConsumedTopic, partitionLabel(dl.msg.Partition), decisionDeadLetter)
+	}
+	return nil
+}
+
+// deadLetter message dead-lettered in a transaction.
+type deadLetter struct {
+	msg   *Message
+	cause error
+}
+
+// transform calls the handler with the messages of the batch, produces their
+// outputs and adds the offset of the batch to the transaction. With
+// DeadLetter, the messages which could not be decoded or handled are
+// published to the dead-letter topic in the transaction, so they are only
+// dead-lettered if it commits. Otherwise the decode failures are handled by
+// handleFailure and the handler failures abort the transaction.
+func (c *ConsumerGroupHandler) transform(session sarama.ConsumerGroupSession, txn *transaction, batch []*sarama.ConsumerMessage) (deadLetters []deadLetter, err error) {
+	ctx := session.Context()
+	var outputs []*sarama.ProducerMessage
+	for _, message := range batch {
+		msg, err := c.decode(message, nil)
+		decoded := err == nil
+		var results []*Message
+		if decoded {
+			if results, err = c.cfg.Transactional.Handler(ctx, msg); err != nil {
+				c.metrics.callbackErrors.Inc(message.Topic, partitionLabel(message.Partition))
+			}
+		}
+		if err != nil {
+			if c.cfg.DeadLetter != nil {
+				// Otherwise the message would abort the transaction after every rejoin.
+				outputs = append(outputs, republished(msg, c.cfg.DeadLetter.topic(sourceTopic(msg)), err))
+				deadLetters = append(deadLetters, deadLetter{msg: msg, cause: err})
+				continue
+			}
+			if !decoded && c.handleFailure(ctx, msg, err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, result := range results {
+			pm, err := c.cfg.Transactional.Producer.producerMessage(result)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, pm)
+		}
+	}
+	if err := txn.produce(outputs); err != nil {
+		return nil, err
+	}
+	// The messages of a batch belong to the same partition, the offset of the
+	// last one commits all of them.
+	if err := txn.producer.AddMessageToTxn(batch[len(batch)-1], c.cfg.Group, nil); err != nil {
+		return nil, fmt.Errorf("unable to add the offsets to the transaction: %w", err)
+	}
+	return deadLetters, nil
+}
+
+// abort aborts the current transaction which failed with cause.
+func (c *ConsumerGroupHandler) abort(txn *transaction, first *sarama.ConsumerMessage, cause error) error {
+	c.metrics.transactions.Inc(c.cfg.Group, txnAborted)
+	c.cfg.Logger.WithError(cause).Errorf("Aborting the transaction. topic = %s, partition = %d, offset = %d",
+		first.Topic, first.Partition, first.Offset)
+	if err := txn.producer.AbortTxn(); err != nil {
+		return fmt.Errorf("unable to abort the transaction after %v: %w", cause, err)
+	}
+	return fmt.Errorf("transaction aborted: %w", cause)
+}
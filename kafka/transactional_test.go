@@ -0,0 +1,334 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/udayangaac/sterna/metrics"
+)
+
+// txnProducer records the transactions of the mock producer.
+type txnProducer struct {
+	*mocks.AsyncProducer
+	offsets []int64
+	commits int
+	aborts  int
+}
+
+func (p *txnProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupID string, metadata *string) error {
+	p.offsets = append(p.offsets, msg.Offset)
+	return p.AsyncProducer.AddMessageToTxn(msg, groupID, metadata)
+}
+
+func (p *txnProducer) CommitTxn() error {
+	p.commits++
+	return p.AsyncProducer.CommitTxn()
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.aborts++
+	return p.AsyncProducer.AbortTxn()
+}
+
+func newTestTransactionalConfig(handler TransformHandler) ConsumerConfig {
+	return ConsumerConfig{
+		ClientConfig: ClientConfig{
+			Brokers: []string{"localhost:9092"},
+			Version: Version_2_1_1,
+			Metrics: metrics.NewRegistry(),
+		},
+		Group:           "group",
+		Topics:          []string{"orders"},
+		BalanceStrategy: Range,
+		Decoder:         GetDefaultDecoder(),
+		Transactional: &TransactionalPolicy{
+			Producer: ProducerConfig{TransactionalID: "payments"},
+			Handler:  handler,
+		},
+	}
+}
+
+// txnProducers mock transactional producers created for the claims.
+type txnProducers struct {
+	ids       []string
+	producers []*txnProducer
+	mu        sync.Mutex
+}
+
+func (p *txnProducers) get(i int) *txnProducer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.producers[i]
+}
+
+// newTestTransactionalHandler creates a handler whose claims use mock
+// producers with the expectations set by expect.
+func newTestTransactionalHandler(t *testing.T, cfg ConsumerConfig, expect func(p *txnProducer)) (*ConsumerGroupHandler, *txnProducers) {
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	config, err := cfg.Transactional.Producer.saramaConfig()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	producers := &txnProducers{}
+	h := getConsumerGroupHandler(cfg)
+	h.newTransaction = func(cfg ProducerConfig) (*transaction, error) {
+		p := &txnProducer{AsyncProducer: mocks.NewAsyncProducer(t, config)}
+		if expect != nil {
+			expect(p)
+		}
+		producers.mu.Lock()
+		defer producers.mu.Unlock()
+		producers.ids = append(producers.ids, cfg.TransactionalID)
+		producers.producers = append(producers.producers, p)
+		return &transaction{producer: p}, nil
+	}
+	return h, producers
+}
+
+// upper produces the upper cased value of the message to the payments topic.
+func upper(ctx context.Context, msg *Message) ([]*Message, error) {
+	if msg.Value == "bad" {
+		return nil, errors.New("unable to transform")
+	}
+	value := strings.ToUpper(msg.Value.(string))
+	return []*Message{{Topic: "payments", Key: msg.Key, RawValue: []byte(value)}}, nil
+}
+
+func TestConsumerGroupHandler_Transactional(t *testing.T) {
+	h, producers := newTestTransactionalHandler(t, newTestTransactionalConfig(upper), func(p *txnProducer) {
+		p.ExpectInputWithMessageCheckerFunctionAndSucceed(expectMessage("a", "A"))
+		p.ExpectInputWithMessageCheckerFunctionAndSucceed(expectMessage("b", "B"))
+	})
+	session := newMockSession()
+	if err := h.ConsumeClaim(session, newMockClaim("orders", 3, "a", "b")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	// The partition has its own producer.
+	if !reflect.DeepEqual(producers.ids, []string{"payments-orders-3"}) {
+		t.Errorf("Expected the transactional id of the partition, got %v", producers.ids)
+	}
+	// The fetched messages are processed in a single transaction.
+	p := producers.get(0)
+	if p.commits != 1 || p.aborts != 0 {
+		t.Errorf("Expected a committed transaction, got %d commits and %d aborts", p.commits, p.aborts)
+	}
+	if !reflect.DeepEqual(p.offsets, []int64{1}) {
+		t.Errorf("Expected the offset of the last message in the transaction, got %v", p.offsets)
+	}
+	if len(session.markedOffsets()) != 0 {
+		t.Errorf("Expected no offset to be marked, got %v", session.markedOffsets())
+	}
+	buf := &bytes.Buffer{}
+	_ = h.cfg.Metrics.WriteText(buf)
+	if !strings.Contains(buf.String(), `sterna_kafka_consumer_transactions_total{group="group",result="committed"} 1`) {
+		t.Errorf("Expected the committed transaction metric, got\n%s", buf)
+	}
+}
+
+func TestConsumerGroupHandler_TransactionalAbort(t *testing.T) {
+	h, producers := newTestTransactionalHandler(t, newTestTransactionalConfig(upper), nil)
+	err := h.ConsumeClaim(newMockSession(), newMockClaim("orders", 0, "a", "bad", "c"))
+	if err == nil || !strings.Contains(err.Error(), "unable to transform") {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+	p := producers.get(0)
+	if p.commits != 0 || p.aborts != 1 || len(p.offsets) != 0 {
+		t.Errorf("Expected an aborted transaction, got %d commits, %d aborts and offsets %v", p.commits, p.aborts, p.offsets)
+	}
+	if !h.reset() {
+		t.Errorf("Expected the failed claim to be recorded")
+	}
+}
+
+// expectTopic checks the topic of the produced message.
+func expectTopic(topic string) mocks.MessageChecker {
+	return func(pm *sarama.ProducerMessage) error {
+		if pm.Topic != topic {
+			return fmt.Errorf("expected topic %s, got %s", topic, pm.Topic)
+		}
+		return nil
+	}
+}
+
+func TestConsumerGroupHandler_TransactionalDeadLetter(t *testing.T) {
+	dlq := &mockProducer{}
+	cfg := newTestTransactionalConfig(upper)
+	cfg.DeadLetter = &DeadLetterPolicy{Producer: dlq}
+	h, producers := newTestTransactionalHandler(t, cfg, func(p *txnProducer) {
+		p.ExpectInputWithMessageCheckerFunctionAndSucceed(expectMessage("a", "A"))
+		p.ExpectInputWithMessageCheckerFunctionAndSucceed(expectTopic("orders.dlq"))
+		p.ExpectInputWithMessageCheckerFunctionAndSucceed(expectMessage("c", "C"))
+	})
+	if err := h.ConsumeClaim(newMockSession(), newMockClaim("orders", 0, "a", "bad", "c")); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	// The failed message is dead-lettered in the transaction and committed with the others.
+	p := producers.get(0)
+	if p.commits != 1 || p.aborts != 0 || !reflect.DeepEqual(p.offsets, []int64{2}) {
+		t.Errorf("Expected a committed transaction, got %d commits, %d aborts and offsets %v", p.commits, p.aborts, p.offsets)
+	}
+	if len(dlq.messages) != 0 {
+		t.Errorf("Expected no message from the dead-letter producer, got %v", dlq.messages)
+	}
+}
+
+func TestConsumerGroupHandler_TransactionalDeadLetterAborted(t *testing.T) {
+	dlq := &mockProducer{}
+	cfg := newTestTransactionalConfig(upper)
+	cfg.DeadLetter = &DeadLetterPolicy{Producer: dlq}
+	h, producers := newTestTransactionalHandler(t, cfg, func(p *txnProducer) {
+		p.ExpectInputWithMessageCheckerFunctionAndSucceed(expectTopic("orders.dlq"))
+		p.ExpectInputAndFail(sarama.ErrNotEnoughReplicas)
+	})
+	err := h.ConsumeClaim(newMockSession(), newMockClaim("orders", 0, "bad", "c"))
+	if !errors.Is(err, sarama.ErrNotEnoughReplicas) {
+		t.Errorf("Expected the produce error, got %v", err)
+	}
+
+	// The dead-letter record belongs to the aborted transaction and is not published again outside of it.
+	p := producers.get(0)
+	if p.commits != 0 || p.aborts != 1 || len(p.offsets) != 0 {
+		t.Errorf("Expected an aborted transaction, got %d commits, %d aborts and offsets %v", p.commits, p.aborts, p.offsets)
+	}
+	if len(dlq.messages) != 0 {
+		t.Errorf("Expected no dead-lettered message, got %v", dlq.messages)
+	}
+}
+
+func TestConsumerGroupHandler_TransactionalProduceFailure(t *testing.T) {
+	h, producers := newTestTransactionalHandler(t, newTestTransactionalConfig(upper), func(p *txnProducer) {
+		p.ExpectInputAndFail(sarama.ErrNotEnoughReplicas)
+	})
+	err := h.ConsumeClaim(newMockSession(), newMockClaim("orders", 0, "a"))
+	if !errors.Is(err, sarama.ErrNotEnoughReplicas) {
+		t.Errorf("Expected the produce error, got %v", err)
+	}
+	p := producers.get(0)
+	if p.commits != 0 || p.aborts != 1 {
+		t.Errorf("Expected an aborted transaction, got %d commits and %d aborts", p.commits, p.aborts)
+	}
+}
+
+// claimClient consumes a claim of the given values in every session and, like
+// sarama, ends the session without an error when the claim fails.
+type claimClient struct {
+	mockClient
+	values []string
+	starts []time.Time
+}
+
+func (m *claimClient) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	m.mu.Lock()
+	m.starts = append(m.starts, time.Now())
+	sessions := len(m.starts)
+	m.mu.Unlock()
+	if sessions > 2 {
+		<-ctx.Done()
+		return nil
+	}
+	session := newMockSession()
+	if err := handler.Setup(session); err != nil {
+		return err
+	}
+	_ = handler.ConsumeClaim(session, newMockClaim(topics[0], 0, m.values...))
+	return handler.Cleanup(session)
+}
+
+func TestConsumerGroup_TransactionalRejoinBackoff(t *testing.T) {
+	cfg := newTestTransactionalConfig(upper)
+	cfg.RejoinBackoff = 20 * time.Millisecond
+	h, producers := newTestTransactionalHandler(t, cfg, nil)
+	cg := &consumerGroup{cfg: h.cfg}
+	client := &claimClient{values: []string{"bad"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cg.consume(ctx, client, h) }()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		client.mu.Lock()
+		sessions := len(client.starts)
+		client.mu.Unlock()
+		if sessions == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Consumer group did not rejoin, %d sessions", sessions)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected consume to return without error, got %s", err)
+	}
+
+	// The aborted sessions are joined again with the doubling rejoin backoff.
+	for i, backoff := range []time.Duration{cfg.RejoinBackoff, 2 * cfg.RejoinBackoff} {
+		if gap := client.starts[i+1].Sub(client.starts[i]); gap < backoff {
+			t.Errorf("Expected session %d to be joined after %v, got %v", i+2, backoff, gap)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if p := producers.get(i); p.aborts != 1 || p.commits != 0 {
+			t.Errorf("Expected an aborted transaction in session %d, got %d commits and %d aborts", i+1, p.commits, p.aborts)
+		}
+	}
+}
+
+func TestConsumerConfig_ValidateTransactional(t *testing.T) {
+	cfg := newTestTransactionalConfig(upper)
+	// The dead letters are produced in the transactions.
+	cfg.DeadLetter = &DeadLetterPolicy{}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	producer := cfg.Transactional.Producer
+	if cfg.IsolationLevel != ReadCommitted || !producer.Idempotent ||
+		!reflect.DeepEqual(producer.Brokers, cfg.Brokers) {
+		t.Errorf("Unexpected transactional configurations %+v", cfg)
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if config.Consumer.IsolationLevel != sarama.ReadCommitted {
+		t.Errorf("Expected the read committed isolation level, got %v", config.Consumer.IsolationLevel)
+	}
+
+	invalid := newTestTransactionalConfig(nil)
+	invalid.Transactional.Producer = ProducerConfig{Compression: "brotli"}
+	invalid.Concurrency = 4
+	invalid.CommitMode = CommitSync
+	err = invalid.validate()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	for _, field := range []string{
+		"Transactional", "Transactional.Handler", "Transactional.Producer.TransactionalID",
+		"Transactional.Producer.Compression", "CommitMode",
+	} {
+		if !errs.Has(field) {
+			t.Errorf("Expected an error of %s, got %s", field, errs)
+		}
+	}
+}
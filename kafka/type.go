@@ -7,6 +7,8 @@
 package kafka
 
 import (
+	"context"
+
 	"github.com/Shopify/sarama"
 	"github.com/udayangaac/sterna/kafka/avro"
 )
@@ -23,10 +25,29 @@ type Offset string
 // ConsumerCallback hanler function for the consumer.
 type ConsumerCallback func(key, value interface{}) (err error)
 
+// BatchConsumerCallback handler function for the batches of messages consumed
+// from a partition. Return a *BatchError to report the failure of individual
+// messages; any other error fails all the messages of the batch.
+type BatchConsumerCallback func(ctx context.Context, messages []*Message) (err error)
+
 // ConsumerErrorHandler hanlde the error returning from the ConsumerCallback.
 type ConsumerErrorHandler func(err error) (commitMsg bool)
 
+// RebalanceListener receives the partitions assigned to and revoked from the
+// consumer group member in every session.
+type RebalanceListener interface {
+	// OnPartitionsAssigned is called when a new session starts, before the
+	// messages of the partitions are consumed.
+	OnPartitionsAssigned(generationID int32, partitions map[string][]int32)
+	// OnPartitionsRevoked is called when the session ends, after all the
+	// claims are processed.
+	OnPartitionsRevoked(generationID int32, partitions map[string][]int32)
+}
+
 // Decoder decode the consumer message to according to the given implementation
 type Decoder func(consumerMessage *sarama.ConsumerMessage) (key, value interface{}, err error)
 
 type Encoder func(schemaStore avro.SchemaStore, schema string, data []byte) sarama.Encoder
+
+// KeyEncoder encodes the keys of the produced messages.
+type KeyEncoder func(key interface{}) (sarama.Encoder, error)
@@ -0,0 +1,155 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Deserializer converts the key or the value returned by the Decoder to T.
+type Deserializer[T any] interface {
+	Deserialize(data interface{}) (T, error)
+}
+
+// Serializer converts T to the data given to the EncoderBuilder.
+type Serializer[T any] interface {
+	Serialize(v T) (interface{}, error)
+}
+
+// Serde serializer and deserializer of T.
+type Serde[T any] interface {
+	Serializer[T]
+	Deserializer[T]
+}
+
+type stringSerde struct{}
+
+// StringSerde serde of string keys and values.
+func StringSerde() Serde[string] {
+	return stringSerde{}
+}
+
+func (stringSerde) Deserialize(data interface{}) (string, error) {
+	switch v := data.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected a string, got %T", data)
+	}
+}
+
+func (stringSerde) Serialize(v string) (interface{}, error) {
+	return v, nil
+}
+
+type jsonSerde[T any] struct{}
+
+// JSONSerde serde of T encoded as JSON. It deserializes the JSON strings
+// returned by GetDefaultDecoder and GetAvroDecoder, and serializes to T, which
+// the encoder builders marshal.
+func JSONSerde[T any]() Serde[T] {
+	return jsonSerde[T]{}
+}
+
+func (jsonSerde[T]) Deserialize(data interface{}) (v T, err error) {
+	switch d := data.(type) {
+	case T:
+		return d, nil
+	case string:
+		err = json.Unmarshal([]byte(d), &v)
+	case []byte:
+		err = json.Unmarshal(d, &v)
+	default:
+		err = fmt.Errorf("expected a JSON string, got %T", data)
+	}
+	return v, err
+}
+
+func (jsonSerde[T]) Serialize(v T) (interface{}, error) {
+	return v, nil
+}
+
+// TypedMessage consumed message with the key and the value deserialized to K and V.
+type TypedMessage[K, V any] struct {
+	*Message
+	Key   K
+	Value V
+}
+
+// TypedHandler handles the typed messages.
+type TypedHandler[K, V any] func(ctx context.Context, msg *TypedMessage[K, V]) (err error)
+
+// Typed adapts a TypedHandler to a Handler, e.g. to use it in a Route.
+// Deserialization errors are handled like the handler errors.
+func Typed[K, V any](key Deserializer[K], value Deserializer[V], handler TypedHandler[K, V]) Handler {
+	return func(ctx context.Context, msg *Message) (err error) {
+		typed := &TypedMessage[K, V]{Message: msg}
+		if typed.Key, err = key.Deserialize(msg.Key); err != nil {
+			return fmt.Errorf("unable to deserialize the key: %w", err)
+		}
+		if typed.Value, err = value.Deserialize(msg.Value); err != nil {
+			return fmt.Errorf("unable to deserialize the value: %w", err)
+		}
+		return handler(ctx, typed)
+	}
+}
+
+// TypedConsumer consumer group calling a TypedHandler.
+type TypedConsumer[K, V any] struct {
+	ConsumerGroup
+}
+
+// NewTypedConsumer creates a consumer group which deserializes the decoded
+// keys and values to K and V and calls the handler.
+func NewTypedConsumer[K, V any](cfg ConsumerConfig, key Deserializer[K], value Deserializer[V], handler TypedHandler[K, V]) (*TypedConsumer[K, V], error) {
+	cfg.Handler = Typed(key, value, handler)
+	cg, err := NewConsumerGroup(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedConsumer[K, V]{ConsumerGroup: cg}, nil
+}
+
+// TypedProducer produces messages with keys of K and values of V.
+type TypedProducer[K, V any] struct {
+	producer Producer
+	schema   string
+	key      Serializer[K]
+	value    Serializer[V]
+}
+
+// NewTypedProducer creates a typed producer. The serialized keys and values
+// are encoded by the KeyEncoder and the EncoderBuilder of the producer, the
+// values with the given schema subject.
+func NewTypedProducer[K, V any](producer Producer, schema string, key Serializer[K], value Serializer[V]) *TypedProducer[K, V] {
+	return &TypedProducer[K, V]{
+		producer: producer,
+		schema:   schema,
+		key:      key,
+		value:    value,
+	}
+}
+
+// Produce produce the message to the given topic. A value serialized to nil
+// is sent as a tombstone. It returns -1, -1 on errors.
+func (p *TypedProducer[K, V]) Produce(ctx context.Context, topic string, key K, value V) (partition int32, offset int64, err error) {
+	k, err := p.key.Serialize(key)
+	if err != nil {
+		return -1, -1, fmt.Errorf("unable to serialize the key: %w", err)
+	}
+	v, err := p.value.Serialize(value)
+	if err != nil {
+		return -1, -1, fmt.Errorf("unable to serialize the value: %w", err)
+	}
+	return p.producer.ProduceMessage(ctx, &Message{Topic: topic, Key: k, Value: v, Schema: p.schema})
+}
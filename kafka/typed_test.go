@@ -0,0 +1,96 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package kafka
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+type order struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+}
+
+func TestTypedProducerConsumer(t *testing.T) {
+	var produced *sarama.ProducerMessage
+	producer := newTestProducer(t, func(config *sarama.Config) sarama.SyncProducer {
+		mock := mocks.NewSyncProducer(t, config)
+		mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+			produced = pm
+			return nil
+		})
+		return mock
+	})
+	// The configured encoders of the producer are used.
+	producer.cfg.KeyEncoder = func(key interface{}) (sarama.Encoder, error) {
+		return sarama.StringEncoder("tenant-1/" + key.(string)), nil
+	}
+	typedProducer := NewTypedProducer[string, order](producer, "orders-value", StringSerde(), JSONSerde[order]())
+	if _, _, err := typedProducer.Produce(context.Background(), "orders", "o-1", order{ID: "o-1", Amount: 10.5}); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	if err := expectMessage("tenant-1/o-1", `{"id":"o-1","amount":10.5}`)(produced); err != nil {
+		t.Fatalf("Unexpected produced message: %s", err)
+	}
+
+	var received *TypedMessage[string, order]
+	cfg := newTestConfig(func(key, value interface{}) error { return nil })
+	consumer, err := NewTypedConsumer[string, order](cfg, StringSerde(), JSONSerde[order](), func(ctx context.Context, msg *TypedMessage[string, order]) error {
+		received = msg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	claim := newMockClaim("orders", 0)
+	claim.messages = make(chan *sarama.ConsumerMessage, 1)
+	claim.messages <- consumed(produced)
+	close(claim.messages)
+	handler := getConsumerGroupHandler(consumer.ConsumerGroup.(*consumerGroup).cfg)
+	if err := handler.ConsumeClaim(newMockSession(), claim); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+
+	if received == nil {
+		t.Fatalf("Expected the message to be handled")
+	}
+	if received.Key != "tenant-1/o-1" || received.Value != (order{ID: "o-1", Amount: 10.5}) || received.Topic != "orders" {
+		t.Errorf("Unexpected message %+v", received)
+	}
+}
+
+// failingSerde fails to serialize the values.
+type failingSerde struct {
+	Serde[string]
+}
+
+func (failingSerde) Serialize(v string) (interface{}, error) {
+	return nil, errors.New("unable to serialize")
+}
+
+func TestTypedProducer_SerializeError(t *testing.T) {
+	typedProducer := NewTypedProducer[string, string](&mockProducer{}, "orders-value", StringSerde(), failingSerde{StringSerde()})
+	partition, offset, err := typedProducer.Produce(context.Background(), "orders", "o-1", "a")
+	if err == nil || partition != -1 || offset != -1 {
+		t.Errorf("Expected an error with -1, -1, got %v, %d and %d", err, partition, offset)
+	}
+}
+
+func TestTyped_DeserializeError(t *testing.T) {
+	handler := Typed[string, order](StringSerde(), JSONSerde[order](), func(ctx context.Context, msg *TypedMessage[string, order]) error {
+		t.Errorf("Expected the handler not to be called")
+		return nil
+	})
+	if err := handler(context.Background(), &Message{Key: "o-1", Value: "not json"}); err == nil {
+		t.Errorf("Expected a deserialization error")
+	}
+}
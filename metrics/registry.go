@@ -0,0 +1,228 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package metrics provides counters, gauges and histograms rendered in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// DefaultBuckets default histogram buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry registry used by the framework modules unless configured otherwise.
+var DefaultRegistry = NewRegistry()
+
+// Registry holds the metric families of the application.
+type Registry struct {
+	families map[string]*family
+	mu       sync.RWMutex
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter returns the counter with the given name, registering it if it does
+// not exist. It panics if the name is registered with a different type or labels.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{family: r.register(name, help, counterType, nil, labels)}
+}
+
+// Gauge returns the gauge with the given name, registering it if it does not
+// exist. It panics if the name is registered with a different type or labels.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{family: r.register(name, help, gaugeType, nil, labels)}
+}
+
+// Histogram returns the histogram with the given name, registering it if it
+// does not exist. DefaultBuckets are used when buckets is empty. It panics if
+// the name is registered with a different type or labels.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{family: r.register(name, help, histogramType, sorted, labels)}
+}
+
+func (r *Registry) register(name, help string, typ metricType, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || strings.Join(f.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Sprintf("metric %s is already registered as %s with labels %v", name, f.typ, f.labels))
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// sortedFamilies returns the families sorted by name.
+func (r *Registry) sortedFamilies() []*family {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	return families
+}
+
+// family a metric with all its label combinations.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	mu      sync.RWMutex
+}
+
+// series a metric with a single combination of label values.
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+	mu          sync.Mutex
+}
+
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &series{labelValues: append([]string(nil), labelValues...)}
+	if f.typ == histogramType {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+func (f *family) delete(labelValues []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.series, strings.Join(labelValues, "\xff"))
+}
+
+func (s *series) add(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value += v
+}
+
+func (s *series) set(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value = v
+}
+
+// Counter a monotonically increasing value.
+type Counter struct {
+	family *family
+}
+
+// Inc increments the counter of the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.family.get(labelValues).add(1)
+}
+
+// Add adds v to the counter of the given label values. Negative values are ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.family.get(labelValues).add(v)
+}
+
+// Gauge a value which can go up and down.
+type Gauge struct {
+	family *family
+}
+
+// Set sets the gauge of the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.family.get(labelValues).set(v)
+}
+
+// Add adds v to the gauge of the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.family.get(labelValues).add(v)
+}
+
+// Inc increments the gauge of the given label values by one.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec decrements the gauge of the given label values by one.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Delete removes the gauge of the given label values.
+func (g *Gauge) Delete(labelValues ...string) {
+	g.family.delete(labelValues)
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	family *family
+}
+
+// Observe adds an observation to the histogram of the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.family.get(labelValues)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, upper := range h.family.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
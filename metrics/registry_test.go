@@ -0,0 +1,73 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package metrics
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	consumed := r.Counter("messages_total", "Messages consumed.", "topic", "partition")
+	consumed.Inc("orders", "0")
+	consumed.Add(2, "orders", "0")
+	consumed.Inc("pay\"ments", "1")
+	r.Gauge("paused", "Paused partitions.").Set(3)
+	latency := r.Histogram("send_seconds", "Send latency.", []float64{0.1, 1}, "topic")
+	latency.Observe(0.05, "orders")
+	latency.Observe(0.5, "orders")
+	r.Counter("unused_total", "Never incremented.")
+
+	if r.Counter("messages_total", "Messages consumed.", "topic", "partition").family != consumed.family {
+		t.Errorf("Expected the registered counter to be reused")
+	}
+
+	mockServer := httptest.NewServer(r.Handler())
+	defer mockServer.Close()
+	resp, err := http.Get(mockServer.URL)
+	if err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	expected := `# HELP messages_total Messages consumed.
+# TYPE messages_total counter
+messages_total{topic="orders",partition="0"} 3
+messages_total{topic="pay\"ments",partition="1"} 1
+# HELP paused Paused partitions.
+# TYPE paused gauge
+paused 3
+# HELP send_seconds Send latency.
+# TYPE send_seconds histogram
+send_seconds_bucket{topic="orders",le="0.1"} 1
+send_seconds_bucket{topic="orders",le="1"} 2
+send_seconds_bucket{topic="orders",le="+Inf"} 2
+send_seconds_sum{topic="orders"} 0.55
+send_seconds_count{topic="orders"} 2
+`
+	if string(body) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != contentType {
+		t.Errorf("Expected content type %s, got %s", contentType, ct)
+	}
+}
+
+func TestRegistry_ConflictingRegistration(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("requests_total", "Requests.", "path")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for conflicting registration")
+		}
+	}()
+	r.Gauge("requests_total", "Requests.", "path")
+}
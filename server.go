@@ -0,0 +1,174 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package sterna consist of all functions of microservice framework.
+package sterna
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/udayangaac/sterna/metrics"
+)
+
+const (
+	managementServerName = "management-server"
+	readinessTimeout     = 5 * time.Second
+
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// CheckFunc checks whether a dependency of the application is ready.
+type CheckFunc func(ctx context.Context) error
+
+type readinessCheck struct {
+	name  string
+	check CheckFunc
+}
+
+type statusResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// managementServer HTTP server exposing liveness, readiness and metrics endpoints.
+type managementServer struct {
+	addr     string
+	mux      *http.ServeMux
+	server   *http.Server
+	registry *metrics.Registry
+	checks   []readinessCheck
+	ready    atomic.Bool
+	failed   chan error
+	mu       sync.RWMutex
+}
+
+func newManagementServer(addr string) *managementServer {
+	ms := &managementServer{
+		addr:     addr,
+		mux:      http.NewServeMux(),
+		registry: metrics.DefaultRegistry,
+		failed:   make(chan error, 1),
+	}
+	ms.mux.HandleFunc("/healthz", ms.healthz)
+	ms.mux.HandleFunc("/readyz", ms.readyz)
+	ms.mux.HandleFunc("/metrics", ms.metrics)
+	return ms
+}
+
+// WithManagementServer enables the management HTTP server on the given
+// address. The server exposes /healthz (liveness), /readyz (readiness) and
+// /metrics (Prometheus text format).
+func (s *Sterna) WithManagementServer(addr string) {
+	s.server.addr = addr
+}
+
+// WithMetricsRegistry sets the registry served by the /metrics endpoint.
+// metrics.DefaultRegistry is served if not set.
+func (s *Sterna) WithMetricsRegistry(registry *metrics.Registry) {
+	s.server.registry = registry
+}
+
+// AddReadinessCheck adds a check aggregated by the /readyz endpoint.
+func (s *Sterna) AddReadinessCheck(name string, check CheckFunc) {
+	s.server.addCheck(name, check)
+}
+
+// Handle registers an additional handler on the management server.
+func (s *Sterna) Handle(pattern string, handler http.Handler) {
+	s.server.mux.Handle(pattern, handler)
+}
+
+func (ms *managementServer) addCheck(name string, check CheckFunc) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.checks = append(ms.checks, readinessCheck{name: name, check: check})
+}
+
+func (ms *managementServer) Start(context.Context) error {
+	listener, err := net.Listen("tcp", ms.addr)
+	if err != nil {
+		return err
+	}
+	ms.server = &http.Server{Handler: ms.mux, ReadHeaderTimeout: readinessTimeout}
+	go func() {
+		if err := ms.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ms.failed <- err
+		}
+	}()
+	return nil
+}
+
+func (ms *managementServer) Stop(ctx context.Context) error {
+	return ms.server.Shutdown(ctx)
+}
+
+func (ms *managementServer) Failed() <-chan error {
+	return ms.failed
+}
+
+// setReady marks whether all the components are started. The readiness
+// endpoint fails while the application is starting or shutting down.
+func (ms *managementServer) setReady(ready bool) {
+	ms.ready.Store(ready)
+}
+
+func (ms *managementServer) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeStatus(w, http.StatusOK, statusResponse{Status: statusOK})
+}
+
+func (ms *managementServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if !ms.ready.Load() {
+		writeStatus(w, http.StatusServiceUnavailable, statusResponse{Status: statusUnavailable})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	ms.mu.RLock()
+	checks := ms.checks
+	ms.mu.RUnlock()
+
+	results := make([]error, len(checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			results[i] = c.check(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	resp := statusResponse{Status: statusOK, Checks: make(map[string]string, len(checks))}
+	code := http.StatusOK
+	for i, c := range checks {
+		if results[i] != nil {
+			resp.Status = statusUnavailable
+			resp.Checks[c.name] = results[i].Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[c.name] = statusOK
+	}
+	writeStatus(w, code, resp)
+}
+
+func (ms *managementServer) metrics(w http.ResponseWriter, r *http.Request) {
+	ms.registry.Handler().ServeHTTP(w, r)
+}
+
+func writeStatus(w http.ResponseWriter, code int, resp statusResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,50 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package sterna
+package sterna
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func getStatus(t *testing.T, handler http.Handler, path string) (int, statusResponse) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	resp := statusResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Unable to decode the response %s", err)
+	}
+	return rec.Code, resp
+}
+
+func TestManagementServer_Readiness(t *testing.T) {
+	ms := newManagementServer(":0")
+	ms.addCheck("producer", func(context.Context) error { return nil })
+	ms.addCheck("consumer", func(context.Context) error { return errors.New("not joined") })
+
+	if code, _ := getStatus(t, ms.mux, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness status %d, got %d", http.StatusOK, code)
+	}
+	if code, _ := getStatus(t, ms.mux, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness status %d while starting, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	ms.setReady(true)
+	code, resp := getStatus(t, ms.mux, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness status %d, got %d", http.StatusServiceUnavailable, code)
+	}
+	expected := map[string]string{"producer": "ok", "consumer": "not joined"}
+	if !reflect.DeepEqual(resp.Checks, expected) {
+		t.Errorf("Expected checks %v, got %v", expected, resp.Checks)
+	}
+}
@@ -6,16 +6,217 @@
 // Package sterna consist of all functions of microservice framework.
 package sterna
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/udayangaac/sterna/log"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
 // Sterna sterna consist of configuration details.
 type Sterna struct {
+	logger          log.Logger
+	shutdownTimeout time.Duration
+	signals         []os.Signal
+	registrations   []*registration
+	server          *managementServer
+	mu              sync.Mutex
+}
+
+// registration a component registered with a name and its dependencies.
+type registration struct {
+	name      string
+	component Component
+	dependsOn []string
 }
 
 // NewSterna creates a new instance of Sterna with default configurations.
 func NewSterna() *Sterna {
-	return &Sterna{}
+	return &Sterna{
+		logger:          log.NewZeroLogger(log.NewConfig()),
+		shutdownTimeout: defaultShutdownTimeout,
+		signals:         []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		server:          newManagementServer(""),
+	}
+}
+
+// WithLogger sets the logger used by the application.
+func (s *Sterna) WithLogger(logger log.Logger) {
+	s.logger = logger
 }
 
-// Start starts the application.
-func (s *Sterna) Start() {
+// WithShutdownTimeout sets the deadline for stopping all the components.
+func (s *Sterna) WithShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
+}
+
+// Register registers a component with a unique name. The component is started
+// after the components it depends on and stopped before them.
+func (s *Sterna) Register(name string, component Component, dependsOn ...string) error {
+	if name == "" {
+		return errors.New("component name should not be empty")
+	}
+	if component == nil {
+		return fmt.Errorf("component %s should not be nil", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.registrations {
+		if r.name == name {
+			return fmt.Errorf("component %s is already registered", name)
+		}
+	}
+	s.registrations = append(s.registrations, &registration{
+		name:      name,
+		component: component,
+		dependsOn: dependsOn,
+	})
+	return nil
+}
+
+// Start starts the application. Components are started in dependency order,
+// then Start blocks until SIGINT/SIGTERM is received, ctx is cancelled or a
+// component fails. Finally the components are stopped in reverse order within
+// the shutdown timeout. The management server, when enabled, is started before
+// and stopped after all the other components.
+func (s *Sterna) Start(ctx context.Context) (err error) {
+	ordered, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, s.signals...)
+	defer stop()
+
+	failures := make(chan error, len(ordered))
+	done := make(chan struct{})
+	defer close(done)
+
+	started := make([]*registration, 0, len(ordered))
+	for _, r := range ordered {
+		s.logger.Infof("Starting component %s", r.name)
+		if err = r.component.Start(ctx); err != nil {
+			err = fmt.Errorf("unable to start component %s: %w", r.name, err)
+			break
+		}
+		started = append(started, r)
+		if f, ok := r.component.(Failer); ok {
+			go watchFailures(r.name, f, failures, done)
+		}
+	}
+
+	if err == nil {
+		s.server.setReady(true)
+		select {
+		case <-ctx.Done():
+			s.logger.Infof("Terminating: %v", ctx.Err())
+		case err = <-failures:
+			s.logger.WithError(err).Errorf("Terminating: component failed")
+		}
+	}
+
+	s.server.setReady(false)
+	if stopErr := s.stopAll(started); stopErr != nil {
+		if err == nil {
+			return stopErr
+		}
+		return fmt.Errorf("%v; %v", err, stopErr)
+	}
+	return err
+}
+
+// stopAll stops the given components in reverse order.
+func (s *Sterna) stopAll(started []*registration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	var errs []string
+	for i := len(started) - 1; i >= 0; i-- {
+		r := started[i]
+		s.logger.Infof("Stopping component %s", r.name)
+		if err := r.component.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", r.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to stop components: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// startOrder sorts the registered components so that every component comes
+// after its dependencies. Components without ordering constraints keep their
+// registration order.
+func (s *Sterna) startOrder() ([]*registration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registrations := s.registrations
+	if s.server.addr != "" {
+		registrations = append([]*registration{{name: managementServerName, component: s.server}}, registrations...)
+	}
+
+	byName := make(map[string]*registration, len(registrations))
+	for _, r := range registrations {
+		byName[r.name] = r
+	}
+	for _, r := range registrations {
+		for _, dep := range r.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("component %s depends on unknown component %s", r.name, dep)
+			}
+		}
+	}
+
+	placed := make(map[string]bool, len(registrations))
+	ordered := make([]*registration, 0, len(registrations))
+	for len(ordered) < len(registrations) {
+		progress := false
+		for _, r := range registrations {
+			if placed[r.name] || !dependenciesPlaced(r, placed) {
+				continue
+			}
+			placed[r.name] = true
+			ordered = append(ordered, r)
+			progress = true
+		}
+		if !progress {
+			var pending []string
+			for _, r := range registrations {
+				if !placed[r.name] {
+					pending = append(pending, r.name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between components: %s", strings.Join(pending, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+func dependenciesPlaced(r *registration, placed map[string]bool) bool {
+	for _, dep := range r.dependsOn {
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
 
+func watchFailures(name string, f Failer, failures chan<- error, done <-chan struct{}) {
+	select {
+	case err, ok := <-f.Failed():
+		if ok && err != nil {
+			failures <- fmt.Errorf("component %s failed: %w", name, err)
+		}
+	case <-done:
+	}
 }
@@ -0,0 +1,110 @@
+// Copyright (C) By Chamith Udayanga - All Rights Reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Written by Chamith Udayanga <udayangaac@gmail.com>, February 2022
+
+// Package sterna
+package sterna
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) component(name string) Component {
+	return NewComponent(
+		func(context.Context) error {
+			r.add("start " + name)
+			return nil
+		},
+		func(context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	)
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestSterna_StartStopOrder(t *testing.T) {
+	rec := &recorder{}
+	s := NewSterna()
+	_ = s.Register("server", rec.component("server"), "consumer")
+	_ = s.Register("consumer", rec.component("consumer"), "producer")
+	_ = s.Register("producer", rec.component("producer"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Found error %s", err)
+	}
+	expected := []string{
+		"start producer", "start consumer", "start server",
+		"stop server", "stop consumer", "stop producer",
+	}
+	if !reflect.DeepEqual(rec.events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, rec.events)
+	}
+}
+
+func TestSterna_DependencyCycle(t *testing.T) {
+	rec := &recorder{}
+	s := NewSterna()
+	_ = s.Register("a", rec.component("a"), "b")
+	_ = s.Register("b", rec.component("b"), "a")
+	if err := s.Start(context.Background()); err == nil {
+		t.Errorf("Expected dependency cycle error")
+	}
+	if len(rec.events) != 0 {
+		t.Errorf("Expected no component to start, got %v", rec.events)
+	}
+}
+
+func TestSterna_StartFailure(t *testing.T) {
+	rec := &recorder{}
+	s := NewSterna()
+	_ = s.Register("a", rec.component("a"))
+	_ = s.Register("b", NewComponent(func(context.Context) error {
+		return errors.New("boom")
+	}, nil), "a")
+	if err := s.Start(context.Background()); err == nil {
+		t.Errorf("Expected start error")
+	}
+	expected := []string{"start a", "stop a"}
+	if !reflect.DeepEqual(rec.events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, rec.events)
+	}
+}
+
+func TestSterna_RunnerFailure(t *testing.T) {
+	s := NewSterna()
+	_ = s.Register("worker", NewRunner(func(ctx context.Context) error {
+		return errors.New("worker crashed")
+	}))
+	done := make(chan error, 1)
+	go func() { done <- s.Start(context.Background()) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expected runner failure")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Sterna did not stop after the runner failed")
+	}
+}